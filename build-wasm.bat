@@ -11,7 +11,11 @@ go build -o ../web/fingerprint.wasm main.go
 
 REM
 for /f "delims=" %%i in ('go env GOROOT') do set GOROOT=%%i
-copy "%GOROOT%\misc\wasm\wasm_exec.js" ..\web\
+if exist "%GOROOT%\lib\wasm\wasm_exec.js" (
+    copy "%GOROOT%\lib\wasm\wasm_exec.js" ..\web\
+) else (
+    copy "%GOROOT%\misc\wasm\wasm_exec.js" ..\web\
+)
 
 echo WASM module built successfully!
 echo Files generated:
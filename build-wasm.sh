@@ -8,7 +8,14 @@ export GOARCH=wasm
 cd wasm
 go build -o ../web/fingerprint.wasm main.go
 
-cp "$(go env GOROOT)/misc/wasm/wasm_exec.js" ../web/
+# Go 1.24 moved wasm_exec.js from misc/wasm to lib/wasm; it must match the
+# toolchain that built the module.
+GOROOT="$(go env GOROOT)"
+if [ -f "$GOROOT/lib/wasm/wasm_exec.js" ]; then
+    cp "$GOROOT/lib/wasm/wasm_exec.js" ../web/
+else
+    cp "$GOROOT/misc/wasm/wasm_exec.js" ../web/
+fi
 
 echo "WASM module built successfully!"
 echo "Files generated:"
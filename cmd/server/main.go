@@ -1,12 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -16,6 +28,12 @@ import (
 	"captcha/internal/database"
 	"captcha/internal/fingerprint"
 	"captcha/internal/handlers"
+	"captcha/internal/logging"
+	"captcha/internal/metrics"
+	"captcha/internal/middleware"
+	"captcha/internal/response"
+	"captcha/internal/webhook"
+	"captcha/pkg/token"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -25,61 +43,246 @@ import (
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", "error", err)
 	}
+	slog.SetDefault(slog.New(logging.NewHandler(os.Stderr, cfg.LogFormat, cfg.LogLevel)))
+
+	// Services and handlers read the configuration through liveCfg, so
+	// SIGHUP can replace it while requests are in flight.
+	liveCfg := &atomic.Pointer[config.Config]{}
+	liveCfg.Store(cfg)
 
 	db, err := database.NewDB(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
 
-	var aesKey []byte
-	if cfg.AESKey != "" {
-		aesKey, err = crypto.DecodeBase64(cfg.AESKey)
+	backfilled, unparseable, err := db.BackfillPlatformNormalized(fingerprint.NormalizePlatform)
+	for _, id := range unparseable {
+		slog.Warn("Stored fingerprint does not parse, normalized platform set to other", "solution_id", id)
+	}
+	if err != nil {
+		slog.Error("Failed to backfill normalized platforms", "error", err)
+	} else if backfilled > 0 {
+		slog.Info("Backfilled normalized platforms", "solutions", backfilled, "unparseable", len(unparseable))
+	}
+
+	aesKeys := crypto.NewKeyStore(uint8(cfg.AESActiveKeyVersion))
+	if len(cfg.AESKeys) > 0 {
+		versions := make([]int, 0, len(cfg.AESKeys))
+		for version := range cfg.AESKeys {
+			versions = append(versions, int(version))
+		}
+		sort.Ints(versions)
+
+		for _, version := range versions {
+			name := fmt.Sprintf("aes_key_v%d", version)
+			aesKey, err := crypto.DecodeBase64(cfg.AESKeys[uint8(version)])
+			if err != nil {
+				auditKeyDecodeFailure(db, name)
+				fatal("Failed to decode configured AES key", "version", version, "error", err)
+			}
+			if err := aesKeys.Add(uint8(version), aesKey); err != nil {
+				auditKeyDecodeFailure(db, name)
+				fatal("Invalid configured AES key", "error", err)
+			}
+			auditKey(db, name, aesKey, false)
+		}
+		slog.Info("Using configured AES keys", "versions", versions, "active", cfg.AESActiveKeyVersion)
+	} else {
+		aesKey, err := crypto.GenerateAESKey()
 		if err != nil {
-			log.Fatalf("Failed to decode configured AES key: %v", err)
+			fatal("Failed to generate AES key", "error", err)
 		}
-		if len(aesKey) != 32 {
-			log.Fatalf("AES key must be exactly 32 bytes, got %d bytes", len(aesKey))
+		if err := aesKeys.Add(uint8(cfg.AESActiveKeyVersion), aesKey); err != nil {
+			fatal("Invalid generated AES key", "error", err)
 		}
-		log.Println("Using configured AES key")
+		auditKey(db, fmt.Sprintf("aes_key_v%d", cfg.AESActiveKeyVersion), aesKey, true)
+		slog.Warn("Using random AES key. Set AES_KEY_v1 in config.env for production!", "aes_key", crypto.EncodeBase64(aesKey))
+	}
+
+	var sealedTokenKey []byte
+	if cfg.SealedTokenPrivateKey != "" {
+		sealedTokenKey, err = crypto.DecodeBase64(cfg.SealedTokenPrivateKey)
+		if err != nil {
+			auditKeyDecodeFailure(db, "sealed_token_key")
+			fatal("Failed to decode sealed token private key", "error", err)
+		}
+		auditKey(db, "sealed_token_key", sealedTokenKey, false)
 	} else {
-		aesKey, err = crypto.GenerateAESKey()
+		sealedTokenKey, err = token.GenerateKey()
 		if err != nil {
-			log.Fatalf("Failed to generate AES key: %v", err)
+			fatal("Failed to generate sealed token key", "error", err)
 		}
-		log.Printf("Generated random AES key: %s", crypto.EncodeBase64(aesKey))
-		log.Println("WARNING: Using random AES key. Set AES_KEY in config.env for production!")
+		auditKey(db, "sealed_token_key", sealedTokenKey, true)
+		slog.Warn("Using random sealed token key. Set SEALED_TOKEN_PRIVATE_KEY in config.env for production!")
 	}
 
-	argon2Service := argon2.NewService(cfg, db)
-	fingerprintValidator := fingerprint.NewValidator(cfg, aesKey)
+	var recipientPublicKey []byte
+	if cfg.SealedTokenRecipientPublicKey != "" {
+		recipientPublicKey, err = crypto.DecodeBase64(cfg.SealedTokenRecipientPublicKey)
+		if err != nil {
+			auditKeyDecodeFailure(db, "sealed_token_recipient_key")
+			fatal("Failed to decode sealed token recipient public key", "error", err)
+		}
+	}
 
-	handler := handlers.NewHandler(cfg, argon2Service, fingerprintValidator, aesKey)
+	sealer, err := token.NewSealer(sealedTokenKey, recipientPublicKey, time.Duration(cfg.SealedTokenTTLSeconds)*time.Second)
+	if err != nil {
+		fatal("Failed to initialize sealed tokens", "error", err)
+	}
+
+	var solutionSigningKey ed25519.PrivateKey
+	if cfg.SolutionSigningKey != "" {
+		seed, err := crypto.DecodeBase64(cfg.SolutionSigningKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			auditKeyDecodeFailure(db, "solution_signing_key")
+			fatal("Solution signing key must be a base64 Ed25519 seed", "seed_bytes", ed25519.SeedSize)
+		}
+		solutionSigningKey = ed25519.NewKeyFromSeed(seed)
+		auditKey(db, "solution_signing_key", seed, false)
+	} else {
+		_, solutionSigningKey, err = ed25519.GenerateKey(nil)
+		if err != nil {
+			fatal("Failed to generate solution signing key", "error", err)
+		}
+		auditKey(db, "solution_signing_key", solutionSigningKey.Seed(), true)
+		slog.Warn("Using random solution signing key. Set SOLUTION_SIGNING_KEY in config.env for production!")
+	}
+
+	var verifyTokenKey []byte
+	if cfg.VerifyTokenKey != "" {
+		verifyTokenKey, err = crypto.DecodeBase64(cfg.VerifyTokenKey)
+		if err != nil {
+			auditKeyDecodeFailure(db, "verify_token_key")
+			fatal("Failed to decode verify token key", "error", err)
+		}
+		auditKey(db, "verify_token_key", verifyTokenKey, false)
+	} else {
+		verifyTokenKey, err = crypto.GenerateRandomBytes(32)
+		if err != nil {
+			fatal("Failed to generate verify token key", "error", err)
+		}
+		auditKey(db, "verify_token_key", verifyTokenKey, true)
+		slog.Warn("Using random verify token key. Set VERIFY_TOKEN_KEY in config.env for production!")
+	}
+
+	argon2Service := argon2.NewService(liveCfg, db)
+	if cfg.EdgeHMACKey != "" {
+		edgeKey, err := crypto.DecodeBase64(cfg.EdgeHMACKey)
+		if err != nil {
+			fatal("Failed to decode edge HMAC key", "error", err)
+		}
+		argon2Service.SetEdgeKey(edgeKey)
+	}
+	fingerprintValidator := fingerprint.NewValidator(liveCfg, db, aesKeys)
+
+	handler := handlers.NewHandler(liveCfg, db, argon2Service, fingerprintValidator, aesKeys, sealer)
+	handler.SetSolutionSigningKey(solutionSigningKey)
+	handler.SetWebhookDispatcher(webhook.NewDispatcher(cfg))
+	handler.SetTokenIssuer(handlers.NewTokenIssuer(verifyTokenKey, time.Duration(cfg.VerifyTokenTTLSeconds)*time.Second))
+
+	// Batches must be signed. Single verifications come from browsers too,
+	// so their signatures are checked only when present, marking the
+	// request as coming from a backend.
+	var verifyHandler http.Handler = http.HandlerFunc(handler.VerifyHandler)
+	var batchVerifyHandler http.Handler = http.HandlerFunc(handler.VerifyBatchHandler)
+	var tokenVerifyHandler http.Handler = http.HandlerFunc(handler.TokenVerifyHandler)
+	if cfg.RequestSigningKey != "" {
+		signingKey, err := crypto.DecodeBase64(cfg.RequestSigningKey)
+		if err != nil {
+			fatal("Failed to decode request signing key", "error", err)
+		}
+		verifyHandler = middleware.OptionalSignature(signingKey)(verifyHandler)
+		batchVerifyHandler = middleware.VerifySignature(signingKey)(batchVerifyHandler)
+		tokenVerifyHandler = middleware.OptionalSignature(signingKey)(tokenVerifyHandler)
+	}
 
 	router := mux.NewRouter()
 
 	api := router.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/challenge", handler.ChallengeHandler).Methods("GET")
-	api.HandleFunc("/verify", handler.VerifyHandler).Methods("POST")
+	api.Use(response.Encoder(cfg.APIResponseCase))
+	api.HandleFunc("/challenge", handler.ChallengeHandler).Methods("GET", "POST")
+	api.HandleFunc("/challenges/batch", handler.ChallengeBatchHandler).Methods("POST")
+	api.Handle("/verify", verifyHandler).Methods("POST")
+	api.Handle("/verify/batch", batchVerifyHandler).Methods("POST")
+	api.HandleFunc("/challenges/{id}/extend", handler.ExtendChallengeHandler).Methods("POST")
 	api.HandleFunc("/health", handler.HealthHandler).Methods("GET")
+	api.HandleFunc("/readyz", handler.ReadyzHandler).Methods("GET")
+	api.HandleFunc("/pubkey", handler.PublicKeyHandler).Methods("GET")
+	api.HandleFunc("/ed25519-pubkey", handler.SolutionPublicKeyHandler).Methods("GET")
+	api.HandleFunc("/params", handler.ParamsHandler).Methods("GET")
+	api.Handle("/token/verify", tokenVerifyHandler).Methods("POST")
+	api.HandleFunc("/token/validate", handler.TokenValidateHandler).Methods("POST")
+	api.HandleFunc("/token/introspect", handler.TokenIntrospectHandler).Methods("POST")
+
+	var adminServer *http.Server
+	if cfg.AdminAPIKey != "" || cfg.AdminPasswordHash != "" {
+		adminHandler := handlers.NewAdminHandler(liveCfg, db, argon2Service, fingerprintValidator)
+
+		// With ADMIN_PORT the admin routes are only reachable on their own
+		// listener, which can be firewalled off from the public one.
+		adminAPI := api
+		if cfg.AdminPort != "" {
+			adminRouter := mux.NewRouter()
+			adminAPI = adminRouter.PathPrefix("/api/v1").Subrouter()
+			adminAPI.Use(response.Encoder(cfg.APIResponseCase))
+			adminServer = &http.Server{
+				Addr:         fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.AdminPort),
+				Handler:      middleware.RequestID(adminRouter),
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 30 * time.Second,
+				IdleTimeout:  120 * time.Second,
+			}
+		}
+
+		admin := adminAPI.PathPrefix("/admin").Subrouter()
+		admin.Use(adminHandler.AuthMiddleware)
+		admin.HandleFunc("/maintenance/cleanup", adminHandler.CleanupHandler).Methods("POST")
+		admin.HandleFunc("/audit", adminHandler.AuditSearchHandler).Methods("GET")
+		admin.HandleFunc("/challenges/{id}", adminHandler.UpdateChallengeMetadataHandler).Methods("PATCH")
+		admin.HandleFunc("/stats", adminHandler.StatsHandler).Methods("GET")
+		admin.HandleFunc("/ip/{ip}/history", adminHandler.IPHistoryHandler).Methods("GET")
+		admin.HandleFunc("/fingerprint-health", adminHandler.FingerprintHealthHandler).Methods("GET")
+		admin.HandleFunc("/difficulty-history", adminHandler.DifficultyHistoryHandler).Methods("GET")
+		admin.HandleFunc("/fingerprint/validate", adminHandler.FingerprintValidateHandler).Methods("POST")
+		admin.HandleFunc("/key-audit", adminHandler.KeyAuditHandler).Methods("GET")
+		admin.HandleFunc("/benchmark", adminHandler.BenchmarkHandler).Methods("POST")
+		admin.HandleFunc("/wasm-integrity", adminHandler.WASMIntegrityHandler).Methods("POST")
+		admin.HandleFunc("/challenges/{id}/hint", adminHandler.HintHandler).Methods("GET")
+		admin.HandleFunc("/pool-status", adminHandler.PoolStatusHandler).Methods("GET")
+	} else {
+		slog.Info("ADMIN_API_KEY and ADMIN_PASSWORD_HASH not set, admin API disabled")
+	}
+
+	if cfg.EnableMetrics {
+		if cfg.MetricsAuthToken == "" {
+			slog.Warn("METRICS_AUTH_TOKEN not set, /metrics is unauthenticated")
+		}
+		router.Handle("/metrics", metrics.Handler(cfg.MetricsAuthToken)).Methods("GET")
+	}
 
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./web/")))
 
 	c := cors.New(cors.Options{
-		AllowedOrigins: cfg.APICORSOrigins,
+		AllowOriginFunc: func(origin string) bool {
+			return originAllowed(liveCfg.Load().APICORSOrigins, origin)
+		},
 		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{middleware.RequestIDHeader},
 		AllowCredentials: true,
+		MaxAge: cfg.CORSMaxAgeSecs,
+		OptionsPassthrough: true,
 	})
 
-	rateLimiter := rate.NewLimiter(
-		rate.Every(time.Duration(cfg.APIRateLimitWindowMins)*time.Minute/time.Duration(cfg.APIRateLimitRequests)),
-		cfg.APIRateLimitRequests,
-	)
+	rateLimiter := newIPRateLimiter(cfg, db)
+	if !cfg.DistributedRateLimit {
+		go rateLimiter.startEviction()
+	}
 
-	finalHandler := rateLimitMiddleware(rateLimiter)(c.Handler(router))
+	finalHandler := middleware.RequestID(rateLimitMiddleware(liveCfg, rateLimiter)(c.Handler(preflightMiddleware(liveCfg)(router))))
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort),
@@ -89,39 +292,336 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
-	go startCleanupRoutine(db, cfg)
+	go startCleanupRoutine(db, liveCfg)
+	go reloadOnSIGHUP(liveCfg)
 
-	log.Printf("Captcha server starting on %s:%s", cfg.ServerHost, cfg.ServerPort)
-	log.Printf("Database: %s:%d/%s", cfg.DBHost, cfg.DBPort, cfg.DBName)
-	log.Printf("Argon2 Config: time=%d, memory=%d, threads=%d, target=%s",
-		cfg.Argon2Time, cfg.Argon2Memory, cfg.Argon2Threads, cfg.Argon2TargetPrefix)
+	slog.Info("Captcha server starting", "addr", server.Addr,
+		"database", fmt.Sprintf("%s:%d/%s", cfg.DBHost, cfg.DBPort, cfg.DBName))
+	slog.Info("Argon2 config", "time", cfg.Argon2Time, "memory", cfg.Argon2Memory,
+		"threads", cfg.Argon2Threads, "target", cfg.Argon2TargetPrefix)
 
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
+	go serve(server, cfg)
+	if adminServer != nil {
+		slog.Info("Admin API listening", "addr", adminServer.Addr)
+		go serve(adminServer, cfg)
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", "error", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			fatal("Admin server forced to shutdown", "error", err)
+		}
+	}
+
+	if err := argon2Service.Shutdown(ctx); err != nil {
+		slog.Warn("Hash worker pool did not drain", "error", err)
+	}
+	fingerprintValidator.Shutdown()
+
+	slog.Info("Server exited")
+}
+
+func serve(server *http.Server, cfg *config.Config) {
+	var err error
+	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
 	}
+	if err != nil && err != http.ErrServerClosed {
+		fatal("Server failed to start", "addr", server.Addr, "error", err)
+	}
+}
 
-	log.Println("Server exited")
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-func rateLimitMiddleware(limiter *rate.Limiter) func(http.Handler) http.Handler {
+// auditKey records a generated key, or a configured key whose hash differs
+// from the last one recorded. Restarting with the same key logs nothing.
+func auditKey(db *database.DB, name string, key []byte, generated bool) {
+	sum := sha256.Sum256(key)
+	keyHash := hex.EncodeToString(sum[:])
+
+	lastHash, err := db.LatestConfigAuditKeyHash(name + "_")
+	if err != nil {
+		slog.Error("Failed to read key audit trail", "key", name, "error", err)
+	}
+
+	entry := &database.ConfigAuditEntry{
+		OldKeyHash: lastHash,
+		NewKeyHash: keyHash,
+		Source:     "config",
+	}
+
+	switch {
+	case generated:
+		entry.EventType = name + "_generated"
+		entry.Source = "generated"
+	case lastHash == keyHash:
+		return
+	case lastHash != "":
+		entry.EventType = name + "_rotated"
+	default:
+		entry.EventType = name + "_loaded"
+	}
+
+	if err := db.WriteConfigAudit(entry); err != nil {
+		slog.Error("Failed to write key audit entry", "key", name, "error", err)
+	}
+}
+
+func auditKeyDecodeFailure(db *database.DB, name string) {
+	entry := &database.ConfigAuditEntry{
+		EventType: name + "_decode_failed",
+		Source:    "config",
+	}
+
+	if err := db.WriteConfigAudit(entry); err != nil {
+		slog.Error("Failed to write key audit entry", "key", name, "error", err)
+	}
+}
+
+type rateLimitKey struct {
+	ip       string
+	endpoint string
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[rateLimitKey]*limiterEntry
+	limits   map[string]int
+	window   time.Duration
+	db       *database.DB
+}
+
+func newIPRateLimiter(cfg *config.Config, db *database.DB) *ipRateLimiter {
+	limiter := &ipRateLimiter{
+		limiters: make(map[rateLimitKey]*limiterEntry),
+		limits: map[string]int{
+			"challenge": cfg.ChallengeRateLimitRequests,
+			"verify":    cfg.VerifyRateLimitRequests,
+			"default":   cfg.APIRateLimitRequests,
+		},
+		window: time.Duration(cfg.APIRateLimitWindowMins) * time.Minute,
+	}
+
+	if cfg.DistributedRateLimit {
+		limiter.db = db
+	}
+
+	return limiter
+}
+
+// allow reports whether the request may proceed and, when it may not, how
+// long the client should wait before retrying.
+func (l *ipRateLimiter) allow(ctx context.Context, ip, endpoint string, cost int) (bool, time.Duration) {
+	// A batch larger than the burst could never be admitted. Charging the
+	// full burst instead lets the handler reject it with a 400.
+	if cost > l.limits[endpoint] {
+		cost = l.limits[endpoint]
+	}
+
+	if l.db == nil {
+		now := time.Now()
+		reservation := l.get(ip, endpoint, now).ReserveN(now, cost)
+		if !reservation.OK() {
+			return false, l.window
+		}
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			return false, delay
+		}
+		return true, 0
+	}
+
+	allowed, err := l.db.RateLimitAcquireN(endpoint+":"+ip, cost, l.limits[endpoint], int(l.window/time.Second))
+	if err != nil {
+		slog.ErrorContext(ctx, "Distributed rate limit check failed, allowing request", "client_ip", ip, "endpoint", endpoint, "error", err)
+		return true, 0
+	}
+	// The sliding window frees one slot per interval on average.
+	return allowed, l.window / time.Duration(l.limits[endpoint])
+}
+
+func (l *ipRateLimiter) get(ip, endpoint string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := rateLimitKey{ip: ip, endpoint: endpoint}
+	entry, ok := l.limiters[key]
+	if !ok {
+		requests := l.limits[endpoint]
+		entry = &limiterEntry{limiter: rate.NewLimiter(rate.Every(l.window/time.Duration(requests)), requests)}
+		l.limiters[key] = entry
+	}
+	entry.lastSeen = now
+
+	return entry.limiter
+}
+
+// evictIdle drops limiters unused for a full window. By then their bucket
+// has refilled, so a fresh limiter behaves the same.
+func (l *ipRateLimiter) evictIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) >= l.window {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+func (l *ipRateLimiter) startEviction() {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l.evictIdle(now)
+	}
+}
+
+func rateLimitEndpoint(path string) string {
+	path = strings.TrimPrefix(path, "/api/v1")
+	switch path {
+	case "/challenge", "/challenges/batch":
+		return "challenge"
+	case "/verify", "/verify/batch":
+		return "verify"
+	default:
+		return "default"
+	}
+}
+
+// rateLimitCost charges batch requests for each item they carry.
+func rateLimitCost(r *http.Request) int {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1")
+	if r.Method != http.MethodPost || (path != "/verify/batch" && path != "/challenges/batch") {
+		return 1
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 1
+	}
+
+	if path == "/challenges/batch" {
+		var batch handlers.ChallengeBatchRequest
+		if err := json.Unmarshal(body, &batch); err != nil || batch.Count < 1 {
+			return 1
+		}
+		return batch.Count
+	}
+
+	var batch handlers.VerifyBatchRequest
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch.Requests) == 0 {
+		return 1
+	}
+
+	return len(batch.Requests)
+}
+
+// reloadOnSIGHUP swaps in a freshly loaded configuration on every SIGHUP.
+// An invalid configuration is logged and the current one kept.
+func reloadOnSIGHUP(liveCfg *atomic.Pointer[config.Config]) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		next, err := config.Load()
+		if err != nil {
+			slog.Error("Configuration reload failed, keeping current configuration", "error", err)
+			continue
+		}
+
+		current := liveCfg.Load()
+		// Calibration only runs at startup; keep its results.
+		if current.Argon2Calibrate && next.Argon2Calibrate {
+			next.Argon2Time, next.Argon2Memory = current.Argon2Time, current.Argon2Memory
+		}
+
+		for _, name := range config.RestartRequired(current, next) {
+			slog.Warn("Setting changed but only takes effect after a restart", "setting", name)
+		}
+
+		liveCfg.Store(next)
+		slog.Info("Configuration reloaded")
+	}
+}
+
+// originAllowed matches API_CORS_ORIGINS entries the way rs/cors does: "*"
+// allows any origin, and one "*" inside an entry matches any substring.
+func originAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(pattern, "*"); ok &&
+			len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func preflightMiddleware(liveCfg *atomic.Pointer[config.Config]) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.Allow() {
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if preflightWithCredentials(r) {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(liveCfg.Load().CORSMaxAgeWithCredsSecs))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func preflightWithCredentials(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/v1/admin") {
+		return true
+	}
+
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if strings.EqualFold(strings.TrimSpace(header), "Authorization") {
+			return true
+		}
+	}
+	return false
+}
+
+func rateLimitMiddleware(cfg *atomic.Pointer[config.Config], limiter *ipRateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := handlers.GetClientIP(r, cfg.Load().TrustedProxyNets)
+			if allowed, retryAfter := limiter.allow(r.Context(), ip, rateLimitEndpoint(r.URL.Path), rateLimitCost(r)); !allowed {
+				metrics.RateLimitHitsTotal.Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
@@ -130,21 +630,34 @@ func rateLimitMiddleware(limiter *rate.Limiter) func(http.Handler) http.Handler
 	}
 }
 
-func startCleanupRoutine(db *database.DB, cfg *config.Config) {
-	ticker := time.NewTicker(time.Duration(cfg.ChallengeCleanupIntervalMins) * time.Minute)
+func startCleanupRoutine(db *database.DB, liveCfg *atomic.Pointer[config.Config]) {
+	ticker := time.NewTicker(time.Duration(liveCfg.Load().ChallengeCleanupIntervalMins) * time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		log.Println("Running cleanup routine...")
+		cfg := liveCfg.Load()
+		start := time.Now()
+		slog.Debug("Running cleanup routine")
 
-		if err := db.CleanupExpiredChallenges(); err != nil {
-			log.Printf("Failed to cleanup expired challenges: %v", err)
+		if result, err := db.ApplyRetentionPolicy(cfg.Retention); err != nil {
+			slog.Error("Failed to apply retention policy", "error", err)
+		} else {
+			slog.Info("Retention cleanup completed",
+				"challenges_solved", result.ChallengesSolved, "challenges_expired", result.ChallengesExpired,
+				"solutions_valid", result.SolutionsValid, "solutions_invalid", result.SolutionsInvalid)
+		}
+
+		if cfg.DistributedRateLimit {
+			if _, err := db.CleanupRateLimitEntries(time.Duration(cfg.APIRateLimitWindowMins) * time.Minute); err != nil {
+				slog.Error("Failed to cleanup rate limit entries", "error", err)
+			}
 		}
 
-		if err := db.CleanupOldSolutions(24 * time.Hour); err != nil {
-			log.Printf("Failed to cleanup old solutions: %v", err)
+		if _, err := db.RecordDifficultySnapshot(len(cfg.Argon2TargetPrefix), cfg.Argon2Memory, cfg.Argon2Time,
+			time.Duration(cfg.ChallengeCleanupIntervalMins)*time.Minute); err != nil {
+			slog.Error("Failed to record difficulty snapshot", "error", err)
 		}
 
-		log.Println("Cleanup routine completed")
+		slog.Info("Cleanup routine completed", "duration_ms", time.Since(start).Milliseconds())
 	}
 } 
\ No newline at end of file
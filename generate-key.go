@@ -3,11 +3,22 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 
 	"captcha/internal/crypto"
 )
 
 func main() {
+	version := 1
+	if len(os.Args) > 1 {
+		v, err := strconv.Atoi(os.Args[1])
+		if err != nil || v < 1 || v > 255 {
+			log.Fatalf("Key version must be between 1 and 255")
+		}
+		version = v
+	}
+
 	key, err := crypto.GenerateAESKey()
 	if err != nil {
 		log.Fatalf("Failed to generate AES key: %v", err)
@@ -18,10 +29,12 @@ func main() {
 	fmt.Println()
 	
 	fmt.Println("1. Add this to your config.env file:")
-	fmt.Printf("AES_KEY=%s\n", crypto.EncodeBase64(key))
+	fmt.Printf("AES_KEY_v%d=%s\n", version, crypto.EncodeBase64(key))
+	fmt.Printf("AES_ACTIVE_KEY_VERSION=%d\n", version)
 	fmt.Println()
 	
-	fmt.Println("2. Replace the aesKey variable in wasm/main.go with:")
+	fmt.Println("2. Replace the aesKeyVersion and aesKey variables in wasm/main.go with:")
+	fmt.Printf("const aesKeyVersion byte = %d\n\n", version)
 	fmt.Println("var aesKey = []byte{")
 	for i, b := range key {
 		if i%8 == 0 {
@@ -0,0 +1,103 @@
+package argon2
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"captcha/internal/database"
+	"golang.org/x/crypto/argon2"
+)
+
+// ChallengeAlgorithm is a proof-of-work hash a challenge can be issued with.
+// The challenge flow in Service is shared; only parameter selection, hashing
+// and the stored-parameter sanity check differ per algorithm.
+type ChallengeAlgorithm interface {
+	Name() string
+	ApplyParams(challenge *database.Challenge)
+	Hash(challenge *database.Challenge, salt []byte, nonce string) (string, error)
+	ParamsInAllowedRange(challenge *database.Challenge) bool
+	EstimateSolveTime(challenge *database.Challenge) time.Duration
+}
+
+// ChallengeAlgorithmFactory resolves the algorithm stored on a challenge row.
+// Rows written before the algorithm column existed are Argon2id.
+type ChallengeAlgorithmFactory struct {
+	algorithms map[string]ChallengeAlgorithm
+}
+
+func NewChallengeAlgorithmFactory(algorithms ...ChallengeAlgorithm) *ChallengeAlgorithmFactory {
+	factory := &ChallengeAlgorithmFactory{algorithms: make(map[string]ChallengeAlgorithm, len(algorithms))}
+	for _, alg := range algorithms {
+		factory.algorithms[alg.Name()] = alg
+	}
+	return factory
+}
+
+func (f *ChallengeAlgorithmFactory) For(name string) (ChallengeAlgorithm, error) {
+	if name == "" {
+		name = algorithm
+	}
+	alg, ok := f.algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported challenge algorithm %q", name)
+	}
+	return alg, nil
+}
+
+type argon2idAlgorithm struct {
+	s *Service
+}
+
+func (a argon2idAlgorithm) Name() string {
+	return algorithm
+}
+
+func (a argon2idAlgorithm) ApplyParams(challenge *database.Challenge) {
+	challenge.Difficulty = a.s.cfg.Load().Argon2Time
+	challenge.Memory = a.s.cfg.Load().Argon2Memory
+	challenge.Threads = a.s.cfg.Load().Argon2Threads
+	challenge.KeyLen = a.s.cfg.Load().Argon2KeyLength
+	challenge.Variant = a.s.cfg.Load().Argon2Variant
+}
+
+func (a argon2idAlgorithm) Hash(challenge *database.Challenge, salt []byte, nonce string) (string, error) {
+	return hashNonce(challenge, salt, nonce), nil
+}
+
+func (a argon2idAlgorithm) ParamsInAllowedRange(challenge *database.Challenge) bool {
+	return challenge.Difficulty <= a.s.cfg.Load().Argon2MaxAllowedTime &&
+		challenge.Memory >= a.s.cfg.Load().Argon2MinAllowedMemory &&
+		challenge.Threads <= a.s.cfg.Load().Argon2MaxAllowedThreads
+}
+
+func (a argon2idAlgorithm) EstimateSolveTime(challenge *database.Challenge) time.Duration {
+	return a.s.estimateArgon2SolveTime(challenge)
+}
+
+type keyFunc func(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte
+
+// variantFunc picks the Argon2 function for a challenge's stored variant, so
+// changing ARGON2_VARIANT does not break challenges already issued. Empty
+// means id, as for rows written before the variant column existed.
+func variantFunc(variant string) keyFunc {
+	if variant == "i" {
+		return argon2.Key
+	}
+	return argon2.IDKey
+}
+
+func hashNonce(challenge *database.Challenge, salt []byte, nonce string) string {
+	inputData := challenge.Salt + nonce
+
+	hash := variantFunc(challenge.Variant)(
+		[]byte(inputData),
+		salt,
+		challenge.Difficulty,
+		challenge.Memory,
+		challenge.Threads,
+		challenge.KeyLen,
+	)
+
+	return hex.EncodeToString(hash)
+}
@@ -1,83 +1,469 @@
 package argon2
 
 import (
-	"crypto/rand"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"captcha/internal/cache"
 	"captcha/internal/config"
 	"captcha/internal/crypto"
 	"captcha/internal/database"
-	"golang.org/x/crypto/argon2"
+	"captcha/internal/idgen"
+	"captcha/internal/logging"
+	"captcha/internal/metrics"
+	"captcha/internal/scrypt"
+	"github.com/lib/pq"
 )
 
+const (
+	algorithm      = "argon2id"
+	honeypotTarget = "0"
+)
+
+// SQLSTATEs raised when IncrementChallengeAttempts pushes attempt_count past
+// max_attempts, and when a nonce races past IsChallengeAttempted into
+// idx_solutions_challenge_nonce.
+const (
+	checkViolation  = "23514"
+	uniqueViolation = "23505"
+)
+
+var (
+	ErrChallengeCorrupted = errors.New("challenge parameters corrupted")
+	ErrHoneypotTriggered  = errors.New("honeypot challenge submitted")
+
+	ErrChallengeMaxAttemptsExceeded = errors.New("challenge attempt limit reached")
+	ErrSessionMismatch              = errors.New("session token does not match challenge")
+	ErrReplay                       = errors.New("nonce already submitted for challenge")
+	ErrAlreadySolved                = errors.New("challenge already solved")
+)
+
+// Fraction of the maximum achievable Shannon entropy (log2 of the sample
+// size, capped at 8 bits) a freshly generated salt must reach.
+const minSaltEntropyRatio = 0.75
+
 type Service struct {
-	cfg *config.Config
+	cfg *atomic.Pointer[config.Config]
 	db  *database.DB
+
+	edgeKey []byte
+
+	algorithms *ChallengeAlgorithmFactory
+
+	pool *WorkerPool
+
+	challengePool *ChallengePool
+
+	cache *cache.ChallengeCache
+
+	ids idgen.Generator
+
+	logger *slog.Logger
+}
+
+// NewService reads cfg on every request, so a reload takes effect without a
+// restart. The worker pool, challenge pool, cache and ID format are fixed
+// from the configuration current at construction.
+func NewService(liveCfg *atomic.Pointer[config.Config], db *database.DB) *Service {
+	cfg := liveCfg.Load()
+	s := &Service{
+		cfg:  liveCfg,
+		db:   db,
+		pool: NewWorkerPool(cfg.Argon2WorkerPoolSize),
+
+		logger: slog.Default(),
+	}
+
+	if cfg.Argon2Calibrate {
+		s.calibrate()
+	}
+
+	// The cache is per instance: with several instances a challenge solved
+	// on one would still look unsolved to the others.
+	if cfg.DistributedRateLimit {
+		s.logger.Info("Challenge cache disabled while DISTRIBUTED_RATE_LIMIT is enabled")
+	} else {
+		challengeCache, err := cache.NewChallengeCache(cfg.ChallengeCacheSize)
+		if err != nil {
+			s.logger.Error("Challenge cache disabled", "error", err)
+		}
+		s.cache = challengeCache
+	}
+
+	var err error
+	s.ids, err = idgen.ForFormat(cfg.ChallengeIDFormat)
+	if err != nil {
+		s.logger.Error("Falling back to hex challenge IDs", "error", err)
+		s.ids = idgen.Hex16{}
+	}
+
+	s.algorithms = NewChallengeAlgorithmFactory(argon2idAlgorithm{s: s}, scrypt.NewService(liveCfg))
+
+	if cfg.ChallengePoolSize > 0 {
+		s.challengePool = NewChallengePool(cfg.ChallengePoolSize, cfg.PoolSaturationAlertThreshold, s.cfg, func() (*database.Challenge, error) {
+			cfg := s.cfg.Load()
+			return s.generateChallenge(context.Background(), cfg.ServerLocation, "", "", database.ChallengeTypeStandard, cfg.Argon2TargetPrefix)
+		})
+		go s.challengePool.run()
+	}
+
+	return s
+}
+
+// ChallengePoolDepth reports how many pre-generated challenges are waiting;
+// zero when the pool is disabled.
+func (s *Service) ChallengePoolDepth() int {
+	if s.challengePool == nil {
+		return 0
+	}
+	return s.challengePool.Depth()
+}
+
+// ChallengePoolStatus reports false when the pool is disabled.
+func (s *Service) ChallengePoolStatus() (PoolStatus, bool) {
+	if s.challengePool == nil {
+		return PoolStatus{}, false
+	}
+	return s.challengePool.Status(), true
+}
+
+// Shutdown drains the hash worker pool; verifications arriving afterwards
+// fail with ErrPoolClosed.
+func (s *Service) Shutdown(ctx context.Context) error {
+	if s.challengePool != nil {
+		s.challengePool.Stop()
+	}
+	return s.pool.Shutdown(ctx)
+}
+
+// calibrate replaces ARGON2_TIME and ARGON2_MEMORY with parameters measured
+// on this machine. Results the verifier would reject keep the static values.
+func (s *Service) calibrate() {
+	cfg := s.cfg.Load()
+	start := time.Now()
+	timeCost, memory, err := Calibrate(cfg.Argon2CalibrateTargetMs, cfg.Argon2CalibrateMaxMemoryMiB)
+	if err != nil {
+		s.logger.Error("Argon2 calibration failed, keeping configured parameters", "error", err)
+		return
+	}
+
+	if timeCost > cfg.Argon2MaxAllowedTime || memory < cfg.Argon2MinAllowedMemory {
+		s.logger.Warn("Calibrated Argon2 parameters are outside the allowed range, keeping configured parameters",
+			"time", timeCost, "memory", memory, "max_allowed_time", cfg.Argon2MaxAllowedTime,
+			"min_allowed_memory", cfg.Argon2MinAllowedMemory)
+		return
+	}
+
+	cfg.Argon2Time = timeCost
+	cfg.Argon2Memory = memory
+	s.logger.Info("Calibrated Argon2 parameters", "time", timeCost, "memory", memory,
+		"target_ms", cfg.Argon2CalibrateTargetMs, "hash_ms", measureHash(timeCost, memory).Milliseconds(),
+		"duration_ms", time.Since(start).Milliseconds())
 }
 
-func NewService(cfg *config.Config, db *database.DB) *Service {
-	return &Service{
-		cfg: cfg,
-		db:  db,
+// GenerateChallenges issues count challenges for one client. If any fails,
+// the ones already stored are deleted so no partial batch is left behind.
+func (s *Service) GenerateChallenges(ctx context.Context, loc *time.Location, clientIP, sessionToken string, count int) ([]*database.Challenge, error) {
+	challenges := make([]*database.Challenge, 0, count)
+	for i := 0; i < count; i++ {
+		challenge, err := s.GenerateChallenge(ctx, loc, clientIP, sessionToken)
+		if err != nil {
+			ids := make([]string, len(challenges))
+			for j, c := range challenges {
+				ids[j] = c.ID
+			}
+			if rollbackErr := s.db.DeleteChallenges(ids); rollbackErr != nil {
+				s.logger.ErrorContext(ctx, "Failed to roll back challenge batch", "client_ip", clientIP, "error", rollbackErr)
+			}
+			for _, id := range ids {
+				s.cache.Remove(id)
+			}
+			return nil, err
+		}
+		challenges = append(challenges, challenge)
 	}
+	return challenges, nil
+}
+
+// SetEdgeKey enables expiry signatures on generated challenges.
+func (s *Service) SetEdgeKey(key []byte) {
+	s.edgeKey = key
+}
+
+// SetLogger replaces the default logger. Call it before serving requests.
+func (s *Service) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// SignExpiry returns an empty string when no edge key is configured.
+func (s *Service) SignExpiry(id string, expiresAt time.Time) string {
+	if len(s.edgeKey) == 0 {
+		return ""
+	}
+	return crypto.GenerateExpirySignature(id, expiresAt, s.edgeKey)
+}
+
+// GenerateChallenge binds the challenge to sessionToken when it is not
+// empty; only its SHA-256 is stored.
+func (s *Service) GenerateChallenge(ctx context.Context, loc *time.Location, clientIP, sessionToken string) (*database.Challenge, error) {
+	if s.challengePool != nil {
+		if challenge := s.challengePool.Get(); challenge != nil {
+			claimed, err := s.claimChallenge(ctx, challenge, loc, clientIP, sessionToken)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "Failed to claim pooled challenge", "challenge_id", challenge.ID, "client_ip", clientIP, "error", err)
+			}
+			if claimed {
+				s.cache.Add(challenge)
+				return challenge, nil
+			}
+		}
+	}
+
+	challenge, err := s.generateChallenge(ctx, loc, clientIP, sessionToken, database.ChallengeTypeStandard, s.cfg.Load().Argon2TargetPrefix)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Add(challenge)
+	return challenge, nil
 }
 
-func (s *Service) GenerateChallenge() (*database.Challenge, error) {
-	salt := make([]byte, s.cfg.Argon2SaltLength)
-	if _, err := rand.Read(salt); err != nil {
+// claimChallenge assigns a pooled challenge to its client and restarts its
+// expiry from now, as if it had just been generated.
+func (s *Service) claimChallenge(ctx context.Context, challenge *database.Challenge, loc *time.Location, clientIP, sessionToken string) (bool, error) {
+	now := time.Now().In(loc)
+	challenge.ClientIP = clientIP
+	challenge.RequestID = logging.RequestID(ctx)
+	challenge.SessionTokenHash = hashSessionToken(sessionToken)
+	challenge.CreatedAt = now
+	challenge.ExpiresAt = now.Add(time.Duration(s.cfg.Load().ChallengeExpiryMinutes) * time.Minute)
+	challenge.ExpirySignature = s.SignExpiry(challenge.ID, challenge.ExpiresAt)
+
+	return s.db.ClaimChallenge(challenge)
+}
+
+// GenerateHoneypotChallenge issues a challenge with a one-character target
+// that looks real to a bot but is never accepted on verify.
+func (s *Service) GenerateHoneypotChallenge(ctx context.Context, loc *time.Location, clientIP string) (*database.Challenge, error) {
+	return s.generateChallenge(ctx, loc, clientIP, "", database.ChallengeTypeHoneypot, honeypotTarget)
+}
+
+func (s *Service) generateChallenge(ctx context.Context, loc *time.Location, clientIP, sessionToken, challengeType, target string) (*database.Challenge, error) {
+	salt, err := crypto.GenerateRandomBytes(s.cfg.Load().Argon2SaltLength)
+	if err != nil {
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
 	}
 
-	challengeID, err := crypto.GenerateRandomBytes(16)
+	if err := checkSaltEntropy(salt); err != nil {
+		return nil, err
+	}
+
+	challengeID, err := s.ids.New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate challenge ID: %w", err)
 	}
 
+	alg, err := s.algorithms.For(s.cfg.Load().PowAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(loc)
+
 	challenge := &database.Challenge{
-		ID:         hex.EncodeToString(challengeID),
+		ID:         challengeID,
 		Salt:       base64.StdEncoding.EncodeToString(salt),
-		Difficulty: s.cfg.Argon2Time,
-		Memory:     s.cfg.Argon2Memory,
-		Threads:    s.cfg.Argon2Threads,
-		KeyLen:     s.cfg.Argon2KeyLength,
-		Target:     s.cfg.Argon2TargetPrefix,
-		CreatedAt:  time.Now(),
-		ExpiresAt:  time.Now().Add(time.Duration(s.cfg.ChallengeExpiryMinutes) * time.Minute),
+		Target:     target,
+		Type:       challengeType,
+		Algorithm:  alg.Name(),
+		ClientIP:   clientIP,
+		CreatedAt:  now,
+
+		SessionTokenHash: hashSessionToken(sessionToken),
+		ExpiresAt:  now.Add(time.Duration(s.cfg.Load().ChallengeExpiryMinutes) * time.Minute),
+		RequestID:  logging.RequestID(ctx),
 	}
+	alg.ApplyParams(challenge)
+	challenge.ParamsDigest = ParamsDigest(challenge)
+	challenge.ExpirySignature = s.SignExpiry(challenge.ID, challenge.ExpiresAt)
 
 	if err := s.db.CreateChallenge(challenge); err != nil {
 		return nil, fmt.Errorf("failed to store challenge: %w", err)
 	}
+	metrics.ChallengesGeneratedTotal.Inc()
 
 	return challenge, nil
 }
 
-func (s *Service) VerifySolution(challengeID, nonce, hash string, fingerprint string, clientIP, userAgent string) (*database.Solution, error) {
-	challenge, err := s.db.GetChallenge(challengeID)
+func hashSessionToken(sessionToken string) string {
+	if sessionToken == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(sessionToken))
+	return hex.EncodeToString(sum[:])
+}
+
+func checkSaltEntropy(salt []byte) error {
+	maxEntropy := math.Log2(math.Min(float64(len(salt)), 256))
+	if entropy := crypto.ShannonEntropy(salt); entropy < maxEntropy*minSaltEntropyRatio {
+		return fmt.Errorf("salt entropy too low (%.2f bits per byte), random source may be broken", entropy)
+	}
+	return nil
+}
+
+func ParamsDigest(challenge *database.Challenge) string {
+	name := challenge.Algorithm
+	if name == "" {
+		name = algorithm
+	}
+	params := fmt.Sprintf("%d|%d|%d|%d|%s", challenge.Difficulty, challenge.Memory, challenge.Threads, challenge.KeyLen, name)
+	// Appended only for non-default variants so digests stored before the
+	// variant column existed still match.
+	if challenge.Variant != "" && challenge.Variant != "id" {
+		params += "|" + challenge.Variant
+	}
+	digest := sha256.Sum256([]byte(params))
+	return hex.EncodeToString(digest[:])
+}
+
+func (s *Service) IsChallengeActive(challengeID string) (bool, error) {
+	challenge, err := s.getChallenge(challengeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get challenge: %w", err)
+	}
+
+	return challenge != nil && !challenge.Solved && time.Now().Before(challenge.ExpiresAt), nil
+}
+
+// ValidChallengeID reports whether id has the shape of the configured
+// CHALLENGE_ID_FORMAT.
+func (s *Service) ValidChallengeID(id string) bool {
+	return s.ids.Valid(id)
+}
+
+// getChallenge prefers the cache; misses are not cached, since a challenge
+// this instance did not issue may be changed by another.
+func (s *Service) getChallenge(id string) (*database.Challenge, error) {
+	if challenge, ok := s.cache.Get(id); ok {
+		return challenge, nil
+	}
+	return s.db.GetChallenge(id)
+}
+
+// ExtendChallengeExpiry returns nil when the challenge cannot be extended.
+func (s *Service) ExtendChallengeExpiry(id string, minutes int) (*time.Time, error) {
+	expiresAt, err := s.db.ExtendChallengeExpiry(id, minutes)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Remove(id)
+	return expiresAt, nil
+}
+
+func (s *Service) GetChallenges(ids []string) (map[string]*database.Challenge, error) {
+	challenges, err := s.db.GetChallenges(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenges: %w", err)
+	}
+
+	byID := make(map[string]*database.Challenge, len(challenges))
+	for _, challenge := range challenges {
+		byID[challenge.ID] = challenge
+	}
+
+	return byID, nil
+}
+
+func (s *Service) VerifySolution(ctx context.Context, challengeID, nonce, hash, sessionToken string, fingerprint, platform string, clientIP, userAgent string) (*database.Solution, error) {
+	challenge, err := s.getChallenge(challengeID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get challenge: %w", err)
 	}
 
+	return s.VerifySolutionWithChallenge(ctx, challenge, challengeID, nonce, hash, sessionToken, fingerprint, platform, clientIP, userAgent)
+}
+
+func (s *Service) VerifySolutionWithChallenge(ctx context.Context, challenge *database.Challenge, challengeID, nonce, hash, sessionToken string, fingerprint, platform string, clientIP, userAgent string) (*database.Solution, error) {
 	if challenge == nil {
 		return nil, fmt.Errorf("challenge not found")
 	}
 
+	if challenge.ParamsDigest != "" && subtle.ConstantTimeCompare([]byte(challenge.ParamsDigest), []byte(ParamsDigest(challenge))) != 1 {
+		metrics.ChallengeCorruptionTotal.Inc()
+		s.logger.ErrorContext(ctx, "Challenge parameters do not match stored digest", "challenge_id", challengeID, "client_ip", clientIP)
+		return nil, ErrChallengeCorrupted
+	}
+
+	// Callers decide whether to block the submitter; they know whether the
+	// request came from a browser or an integrator's backend.
+	if challenge.Type == database.ChallengeTypeHoneypot {
+		return nil, ErrHoneypotTriggered
+	}
+
 	if time.Now().After(challenge.ExpiresAt) {
+		metrics.SolutionsVerifiedTotal.WithLabelValues("expired").Inc()
 		return nil, fmt.Errorf("challenge expired")
 	}
 
 	if challenge.Solved {
-		return nil, fmt.Errorf("challenge already solved")
+		metrics.SolutionsVerifiedTotal.WithLabelValues("replay").Inc()
+		return nil, ErrAlreadySolved
 	}
 
-	valid, err := s.verifySolution(challenge, nonce, hash)
+	// Checked before counting the attempt so another session cannot use up
+	// the owner's attempts.
+	if challenge.SessionTokenHash != "" &&
+		subtle.ConstantTimeCompare([]byte(challenge.SessionTokenHash), []byte(hashSessionToken(sessionToken))) != 1 {
+		return nil, ErrSessionMismatch
+	}
+
+	attempted, err := s.db.IsChallengeAttempted(challengeID, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for replay: %w", err)
+	}
+	if attempted {
+		metrics.SolutionsVerifiedTotal.WithLabelValues("replay").Inc()
+		return nil, ErrReplay
+	}
+
+	attempts, err := s.db.IncrementChallengeAttempts(challengeID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == checkViolation {
+			return nil, ErrChallengeMaxAttemptsExceeded
+		}
+		return nil, fmt.Errorf("failed to record attempt: %w", err)
+	}
+
+	alg, err := s.algorithms.For(challenge.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if !alg.ParamsInAllowedRange(challenge) {
+		if err := s.db.RevokeChallenge(challengeID); err != nil {
+			return nil, fmt.Errorf("failed to revoke challenge: %w", err)
+		}
+		s.cache.Remove(challengeID)
+		return nil, fmt.Errorf("challenge parameters out of allowed range")
+	}
+
+	start := time.Now()
+	valid, err := s.runVerification(alg, challenge, nonce, hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to verify solution: %w", err)
 	}
+	s.logger.DebugContext(ctx, "Solution verified", "challenge_id", challengeID, "client_ip", clientIP,
+		"duration_ms", time.Since(start).Milliseconds(), "valid", valid, "attempt", attempts)
 
 	solutionID, err := crypto.GenerateRandomBytes(16)
 	if err != nil {
@@ -94,58 +480,156 @@ func (s *Service) VerifySolution(challengeID, nonce, hash string, fingerprint st
 		UserAgent:   userAgent,
 		CreatedAt:   time.Now(),
 		Valid:       valid,
+
+		PlatformNormalized: platform,
+		RequestID:          logging.RequestID(ctx),
+	}
+
+	maxValid := 1
+	if s.cfg.Load().AllowMultipleValidNonces {
+		maxValid = s.cfg.Load().MaxValidSolutionsPerChallenge
 	}
 
-	if err := s.db.CreateSolution(solution); err != nil {
+	validCount := 0
+	if valid {
+		validCount, err = s.db.CreateValidSolution(solution, maxValid)
+	} else {
+		err = s.db.CreateSolution(solution)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrValidSolutionCap) {
+			metrics.SolutionsVerifiedTotal.WithLabelValues("replay").Inc()
+			return nil, ErrAlreadySolved
+		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			metrics.SolutionsVerifiedTotal.WithLabelValues("replay").Inc()
+			return nil, ErrReplay
+		}
 		return nil, fmt.Errorf("failed to store solution: %w", err)
 	}
 
 	if valid {
-		if err := s.db.MarkChallengeSolved(challengeID); err != nil {
-			return nil, fmt.Errorf("failed to mark challenge as solved: %w", err)
+		metrics.SolutionsVerifiedTotal.WithLabelValues("valid").Inc()
+	} else {
+		metrics.SolutionsVerifiedTotal.WithLabelValues("invalid").Inc()
+	}
+
+	if valid {
+		if validCount >= maxValid {
+			if err := s.db.MarkChallengeSolved(challengeID); err != nil {
+				return nil, fmt.Errorf("failed to mark challenge as solved: %w", err)
+			}
+			s.cache.MarkSolved(challengeID)
 		}
 	}
 
 	return solution, nil
 }
 
-func (s *Service) verifySolution(challenge *database.Challenge, nonce, providedHash string) (bool, error) {
+func (s *Service) runVerification(alg ChallengeAlgorithm, challenge *database.Challenge, nonce, providedHash string) (bool, error) {
+	var valid bool
+	var err error
+	if poolErr := s.pool.Run(func() {
+		valid, err = s.verifySolution(alg, challenge, nonce, providedHash)
+	}); poolErr != nil {
+		return false, poolErr
+	}
+	return valid, err
+}
+
+func (s *Service) verifySolution(alg ChallengeAlgorithm, challenge *database.Challenge, nonce, providedHash string) (bool, error) {
 	salt, err := base64.StdEncoding.DecodeString(challenge.Salt)
 	if err != nil {
 		return false, fmt.Errorf("failed to decode salt: %w", err)
 	}
 
-	inputData := challenge.Salt + nonce
+	start := time.Now()
+	computedHash, err := alg.Hash(challenge, salt, nonce)
+	metrics.Argon2DurationSeconds.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return false, err
+	}
 
-	hash := argon2.IDKey(
-		[]byte(inputData),
-		salt,
-		challenge.Difficulty,
-		challenge.Memory,
-		challenge.Threads,
-		challenge.KeyLen,
-	)
+	return hashesEqual(computedHash, providedHash) && s.hasValidPrefix(computedHash, challenge.Target), nil
+}
 
-	computedHash := hex.EncodeToString(hash)
+// hashesEqual compares hashes in constant time so a client cannot learn how
+// many leading characters of a guess were correct.
+func hashesEqual(computed, provided string) bool {
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(provided)) == 1
+}
 
-	return computedHash == providedHash && s.hasValidPrefix(computedHash, challenge.Target), nil
+// ComputeHash hashes nonce exactly as verification does, for comparing a
+// client-side solver implementation against the server.
+func (s *Service) ComputeHash(challenge *database.Challenge, nonce string) (string, error) {
+	alg, err := s.algorithms.For(challenge.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(challenge.Salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode salt: %w", err)
+	}
+
+	var hash string
+	if poolErr := s.pool.Run(func() {
+		hash, err = alg.Hash(challenge, salt, nonce)
+	}); poolErr != nil {
+		return "", poolErr
+	}
+	return hash, err
+}
+
+func MatchingPrefixLength(hash, target string) int {
+	n := 0
+	for n < len(hash) && n < len(target) && hash[n] == target[n] {
+		n++
+	}
+	return n
 }
 
 func (s *Service) hasValidPrefix(hash, prefix string) bool {
 	return strings.HasPrefix(hash, prefix)
 }
 
-func (s *Service) EstimateSolveTime() time.Duration {
-	prefixLength := len(s.cfg.Argon2TargetPrefix)
-	estimatedAttempts := 1 << (prefixLength * 4)
+// EstimateSolveTime is how long a visitor's browser is expected to take on
+// challenge, from its own target and the algorithm it was issued with.
+func (s *Service) EstimateSolveTime(challenge *database.Challenge) time.Duration {
+	alg, err := s.algorithms.For(challenge.Algorithm)
+	if err != nil {
+		return s.estimateArgon2SolveTime(challenge)
+	}
+	return alg.EstimateSolveTime(challenge)
+}
+
+// estimateArgon2SolveTime uses ARGON2_CLIENT_HASH_RATE rather than the
+// server's own rate: the WASM solver in a browser is several times slower.
+func (s *Service) estimateArgon2SolveTime(challenge *database.Challenge) time.Duration {
+	estimatedAttempts := math.Pow(16, float64(len(challenge.Target)))
+	estimate := time.Duration(estimatedAttempts / s.cfg.Load().Argon2ClientHashRate * float64(time.Second))
 
-	hashesPerSecond := 100
-	estimatedSeconds := estimatedAttempts / hashesPerSecond
+	maxEstimate := time.Duration(s.cfg.Load().Argon2MaxSolveTime) * time.Second
+	if estimate > maxEstimate {
+		estimate = maxEstimate
+	}
+
+	return estimate
+}
 
-	maxSeconds := s.cfg.Argon2MaxSolveTime
-	if estimatedSeconds > maxSeconds {
-		estimatedSeconds = maxSeconds
+// Benchmark times iterations hashes with the configured Argon2 parameters
+// on this server.
+func (s *Service) Benchmark(iterations int) (float64, error) {
+	salt, err := crypto.GenerateRandomBytes(s.cfg.Load().Argon2SaltLength)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate salt: %w", err)
 	}
 
-	return time.Duration(estimatedSeconds) * time.Second
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		variantFunc(s.cfg.Load().Argon2Variant)([]byte(fmt.Sprintf("benchmark%d", i)), salt, s.cfg.Load().Argon2Time, s.cfg.Load().Argon2Memory,
+			s.cfg.Load().Argon2Threads, s.cfg.Load().Argon2KeyLength)
+	}
+	return float64(iterations) / time.Since(start).Seconds(), nil
 } 
\ No newline at end of file
@@ -0,0 +1,150 @@
+package argon2
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"captcha/internal/config"
+	"captcha/internal/crypto"
+	"captcha/internal/database"
+)
+
+// cycleReader yields the same few bytes over and over, like a broken RNG
+// stuck in a short cycle.
+type cycleReader struct {
+	pattern []byte
+	pos     int
+}
+
+func (r *cycleReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.pattern[r.pos%len(r.pattern)]
+		r.pos++
+	}
+	return len(p), nil
+}
+
+func testService(cfg *config.Config) *Service {
+	liveCfg := &atomic.Pointer[config.Config]{}
+	liveCfg.Store(cfg)
+	return &Service{cfg: liveCfg}
+}
+
+func TestSaltEntropy(t *testing.T) {
+	const saltLength = 16
+
+	for i := 0; i < 1000; i++ {
+		salt, err := crypto.GenerateRandomBytes(saltLength)
+		if err != nil {
+			t.Fatalf("GenerateRandomBytes: %v", err)
+		}
+		if err := checkSaltEntropy(salt); err != nil {
+			t.Fatalf("salt %d from crypto/rand rejected: %v", i, err)
+		}
+	}
+
+	t.Run("low-entropy reader", func(t *testing.T) {
+		crypto.SetRandReader(&cycleReader{pattern: []byte{0x00, 0x01, 0x02, 0x03}})
+		defer crypto.SetRandReader(nil)
+
+		s := testService(&config.Config{Argon2SaltLength: saltLength})
+		_, err := s.generateChallenge(context.Background(), time.UTC, "", "", database.ChallengeTypeStandard, "00")
+		if err == nil || !strings.Contains(err.Error(), "salt entropy too low") {
+			t.Fatalf("generateChallenge error = %v, want salt entropy rejection", err)
+		}
+	})
+}
+
+// BenchmarkHashesEqual should report the same ns/op for every case: the
+// comparison must not return early on the first differing byte.
+func BenchmarkHashesEqual(b *testing.B) {
+	computed := strings.Repeat("a", 64)
+	flip := func(i int) string {
+		provided := []byte(computed)
+		provided[i] ^= 0xff
+		return string(provided)
+	}
+
+	for _, bc := range []struct {
+		name     string
+		provided string
+	}{
+		{"equal", computed},
+		{"first-byte-differs", flip(0)},
+		{"last-byte-differs", flip(len(computed) - 1)},
+		{"all-bytes-differ", strings.Repeat("\x9e", len(computed))},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hashesEqual(computed, bc.provided)
+			}
+		})
+	}
+}
+
+// BenchmarkChallengeLookup compares lookup latency with and without the
+// challenge cache at a steady 100 requests per second. It needs a database,
+// configured through the usual DB_* variables.
+func BenchmarkChallengeLookup(b *testing.B) {
+	if os.Getenv("DB_HOST") == "" {
+		b.Skip("set DB_HOST to benchmark against PostgreSQL")
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		b.Fatalf("config.Load: %v", err)
+	}
+	cfg.ChallengePoolSize = 0
+	cfg.DistributedRateLimit = false
+
+	db, err := database.NewDB(cfg)
+	if err != nil {
+		b.Fatalf("NewDB: %v", err)
+	}
+	defer db.Close()
+
+	liveCfg := &atomic.Pointer[config.Config]{}
+	liveCfg.Store(cfg)
+	s := NewService(liveCfg, db)
+	defer s.Shutdown(context.Background())
+
+	challenge, err := s.GenerateChallenge(context.Background(), time.UTC, "127.0.0.1", "")
+	if err != nil {
+		b.Fatalf("GenerateChallenge: %v", err)
+	}
+	defer db.DeleteChallenges([]string{challenge.ID})
+
+	challengeCache := s.cache
+	for _, bc := range []struct {
+		name   string
+		cached bool
+	}{
+		{"cache", true},
+		{"no-cache", false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s.cache = nil
+			if bc.cached {
+				s.cache = challengeCache
+			}
+
+			ticker := time.NewTicker(time.Second / 100)
+			defer ticker.Stop()
+
+			var total time.Duration
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				<-ticker.C
+				start := time.Now()
+				if _, err := s.getChallenge(challenge.ID); err != nil {
+					b.Fatalf("getChallenge: %v", err)
+				}
+				total += time.Since(start)
+			}
+			b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "ns/lookup")
+		})
+	}
+}
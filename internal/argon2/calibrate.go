@@ -0,0 +1,89 @@
+package argon2
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Bounds of the search. The memory floor matches the MIN_ALLOWED_MEMORY
+	// default so calibrated challenges still pass verification.
+	calibrationMinMemoryMiB = 8
+	calibrationMaxTime      = 10
+
+	calibrationSamples   = 3
+	calibrationTolerance = 0.10
+)
+
+// Calibrate finds Argon2id parameters whose single-threaded hash takes about
+// targetDurationMs on this machine. It raises the time cost until the largest
+// allowed memory reaches the target, then binary searches memory in MiB
+// steps at that time cost. When no step lands within 10% of the target, the
+// closest one measured is returned. memory is in KiB, like ARGON2_MEMORY.
+func Calibrate(targetDurationMs int, maxMemoryMiB int) (timeCost, memory uint32, err error) {
+	if targetDurationMs <= 0 {
+		return 0, 0, fmt.Errorf("calibration target must be positive, got %dms", targetDurationMs)
+	}
+	if maxMemoryMiB < calibrationMinMemoryMiB {
+		return 0, 0, fmt.Errorf("calibration memory limit must be at least %d MiB, got %d", calibrationMinMemoryMiB, maxMemoryMiB)
+	}
+
+	target := time.Duration(targetDurationMs) * time.Millisecond
+	within := func(d time.Duration) bool {
+		diff := d - target
+		if diff < 0 {
+			diff = -diff
+		}
+		return float64(diff) <= calibrationTolerance*float64(target)
+	}
+
+	timeCost = 1
+	for ; timeCost < calibrationMaxTime; timeCost++ {
+		if float64(measureHash(timeCost, uint32(maxMemoryMiB)*1024)) >= (1-calibrationTolerance)*float64(target) {
+			break
+		}
+	}
+
+	bestMemory, bestDiff := uint32(maxMemoryMiB), time.Duration(-1)
+	low, high := uint32(calibrationMinMemoryMiB), uint32(maxMemoryMiB)
+	for low <= high {
+		mid := low + (high-low)/2
+		d := measureHash(timeCost, mid*1024)
+		if within(d) {
+			return timeCost, mid * 1024, nil
+		}
+
+		diff := d - target
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			bestMemory, bestDiff = mid, diff
+		}
+
+		if d < target {
+			low = mid + 1
+		} else if mid == calibrationMinMemoryMiB {
+			break
+		} else {
+			high = mid - 1
+		}
+	}
+
+	return timeCost, bestMemory * 1024, nil
+}
+
+// measureHash returns the mean duration of a single-threaded hash, which is
+// how the WASM solver runs.
+func measureHash(timeCost, memory uint32) time.Duration {
+	password := []byte("calibration")
+	salt := make([]byte, 16)
+
+	start := time.Now()
+	for i := 0; i < calibrationSamples; i++ {
+		argon2.IDKey(password, salt, timeCost, memory, 1, 32)
+	}
+	return time.Since(start) / calibrationSamples
+}
@@ -0,0 +1,198 @@
+package argon2
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"captcha/internal/config"
+	"captcha/internal/database"
+	"captcha/internal/metrics"
+)
+
+// challengePoolLowWater is the fraction of capacity at which a Get wakes the
+// refill goroutine.
+const challengePoolLowWater = 0.2
+
+// challengePoolRetryDelay spaces out refill attempts after a generation
+// failure so a database outage does not turn into a busy loop.
+const challengePoolRetryDelay = 5 * time.Second
+
+// challengePoolFailureWindow is how far back PoolStatus counts generation
+// failures.
+const challengePoolFailureWindow = time.Minute
+
+// ChallengePool keeps challenges that are already stored, unassigned to any
+// client, so issuing one only needs a claim instead of a full generation.
+type ChallengePool struct {
+	challenges chan pooledChallenge
+	refill     chan struct{}
+	stop       chan struct{}
+	cfg        *atomic.Pointer[config.Config]
+	generate   func() (*database.Challenge, error)
+
+	// alertThreshold is the saturation percentage below which a warning is
+	// logged, once per drop.
+	alertThreshold float64
+	alerting       atomic.Bool
+
+	mu       sync.Mutex
+	failures []time.Time
+}
+
+// pooledChallenge remembers the configuration a challenge was generated
+// under, so a reload that changes the Argon2 settings does not hand out
+// challenges verification would now reject.
+type pooledChallenge struct {
+	challenge *database.Challenge
+	cfg       *config.Config
+}
+
+// PoolStatus is a point-in-time view of the challenge pool for operators.
+type PoolStatus struct {
+	Size                         int     `json:"poolSize"`
+	Capacity                     int     `json:"poolCapacity"`
+	SaturationPct                float64 `json:"poolSaturationPct"`
+	GenerationFailuresLastMinute int     `json:"generationFailuresLastMinute"`
+}
+
+func NewChallengePool(size int, alertThreshold float64, cfg *atomic.Pointer[config.Config], generate func() (*database.Challenge, error)) *ChallengePool {
+	return &ChallengePool{
+		challenges:     make(chan pooledChallenge, size),
+		refill:         make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		cfg:            cfg,
+		generate:       generate,
+		alertThreshold: alertThreshold,
+	}
+}
+
+func (p *ChallengePool) run() {
+	for {
+		p.fill()
+
+		select {
+		case <-p.refill:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *ChallengePool) fill() {
+	for len(p.challenges) < cap(p.challenges) {
+		// Loaded before generating, so a reload mid-generation leaves the
+		// entry stamped with the older configuration and Get drops it.
+		cfg := p.cfg.Load()
+		challenge, err := p.generate()
+		if err != nil {
+			metrics.PoolGenerationErrorsTotal.Inc()
+			p.recordFailure(time.Now())
+			slog.Error("Failed to pre-generate challenge", "error", err)
+			select {
+			case <-time.After(challengePoolRetryDelay):
+				continue
+			case <-p.stop:
+				return
+			}
+		}
+
+		select {
+		case p.challenges <- pooledChallenge{challenge: challenge, cfg: cfg}:
+			metrics.ChallengePoolDepth.Set(float64(len(p.challenges)))
+			if p.saturation() >= p.alertThreshold {
+				p.alerting.Store(false)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Get returns a pooled challenge that has not expired yet, or nil when the
+// pool is empty. Expired entries, and those generated before the last
+// configuration reload, are dropped; cleanup removes them once they expire.
+func (p *ChallengePool) Get() *database.Challenge {
+	defer p.checkSaturation()
+	defer p.signalLowWater()
+
+	for {
+		select {
+		case entry := <-p.challenges:
+			metrics.ChallengePoolDepth.Set(float64(len(p.challenges)))
+			if entry.cfg == p.cfg.Load() && time.Now().Before(entry.challenge.ExpiresAt) {
+				return entry.challenge
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *ChallengePool) signalLowWater() {
+	if float64(len(p.challenges)) > float64(cap(p.challenges))*challengePoolLowWater {
+		return
+	}
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (p *ChallengePool) checkSaturation() {
+	saturation := p.saturation()
+	if saturation >= p.alertThreshold || !p.alerting.CompareAndSwap(false, true) {
+		return
+	}
+	slog.Warn("Challenge pool saturation below alert threshold",
+		"saturation_pct", saturation,
+		"threshold_pct", p.alertThreshold,
+		"generation_failures_last_minute", p.failuresSince(time.Now().Add(-challengePoolFailureWindow)))
+}
+
+func (p *ChallengePool) saturation() float64 {
+	return float64(len(p.challenges)) / float64(cap(p.challenges)) * 100
+}
+
+func (p *ChallengePool) recordFailure(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures = append(p.trimFailures(now.Add(-challengePoolFailureWindow)), now)
+}
+
+func (p *ChallengePool) failuresSince(cutoff time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures = p.trimFailures(cutoff)
+	return len(p.failures)
+}
+
+// trimFailures drops failures before cutoff; p.mu must be held.
+func (p *ChallengePool) trimFailures(cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(p.failures) && p.failures[i].Before(cutoff) {
+		i++
+	}
+	return p.failures[i:]
+}
+
+func (p *ChallengePool) Depth() int {
+	return len(p.challenges)
+}
+
+func (p *ChallengePool) Status() PoolStatus {
+	return PoolStatus{
+		Size:                         len(p.challenges),
+		Capacity:                     cap(p.challenges),
+		SaturationPct:                math.Round(p.saturation()*10) / 10,
+		GenerationFailuresLastMinute: p.failuresSince(time.Now().Add(-challengePoolFailureWindow)),
+	}
+}
+
+func (p *ChallengePool) Stop() {
+	close(p.stop)
+}
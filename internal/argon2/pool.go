@@ -0,0 +1,88 @@
+package argon2
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrPoolClosed = errors.New("hash worker pool is shut down")
+
+// WorkerPool runs hash computations on a fixed number of goroutines so a
+// burst of verifications queues instead of starting one Argon2 run per
+// request and oversubscribing the CPU.
+type WorkerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWorkerPool starts size workers.
+func NewWorkerPool(size int) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &WorkerPool{jobs: make(chan func())}
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		job()
+	}
+}
+
+// Run queues fn and blocks until a worker has finished it.
+func (p *WorkerPool) Run(fn func()) error {
+	done := make(chan struct{})
+	job := func() {
+		defer close(done)
+		fn()
+	}
+
+	// The read lock only covers the hand-off, so Shutdown cannot close the
+	// channel under a sender but does not wait on running jobs to get it.
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPoolClosed
+	}
+	p.jobs <- job
+	p.mu.RUnlock()
+
+	<-done
+	return nil
+}
+
+// Shutdown stops accepting work and waits for queued jobs to finish, or
+// for ctx to expire.
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		p.mu.Lock()
+		if !p.closed {
+			p.closed = true
+			close(p.jobs)
+		}
+		p.mu.Unlock()
+
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package argon2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"captcha/internal/config"
+	"captcha/internal/database"
+)
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	const workers, jobs = 3, 50
+
+	pool := NewWorkerPool(workers)
+
+	var running, peak, completed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.Run(func() {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(2 * time.Millisecond)
+				running.Add(-1)
+				completed.Add(1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := completed.Load(); got != jobs {
+		t.Fatalf("completed %d jobs, want %d", got, jobs)
+	}
+	if got := peak.Load(); got > workers {
+		t.Fatalf("%d jobs ran at once, want at most %d", got, workers)
+	}
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := pool.Run(func() {}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Run after Shutdown = %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestChallengePoolDropsChallengesAfterReload(t *testing.T) {
+	var cfg atomic.Pointer[config.Config]
+	cfg.Store(&config.Config{})
+
+	pool := NewChallengePool(3, 0, &cfg, func() (*database.Challenge, error) {
+		return &database.Challenge{ExpiresAt: time.Now().Add(time.Minute)}, nil
+	})
+	pool.fill()
+
+	if pool.Get() == nil {
+		t.Fatal("Get returned nil from a full pool")
+	}
+
+	cfg.Store(&config.Config{})
+	if challenge := pool.Get(); challenge != nil {
+		t.Fatal("Get returned a challenge generated before the reload")
+	}
+	if depth := pool.Depth(); depth != 0 {
+		t.Fatalf("pool kept %d stale challenges, want 0", depth)
+	}
+}
+
+// BenchmarkWorkerPoolHash measures verification-sized Argon2id hashes
+// submitted concurrently through the pool. Compare -cpu values against
+// ARGON2_WORKER_POOL_SIZE when tuning it.
+func BenchmarkWorkerPoolHash(b *testing.B) {
+	for _, size := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", size), func(b *testing.B) {
+			pool := NewWorkerPool(size)
+			defer pool.Shutdown(context.Background())
+
+			salt := make([]byte, 16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := pool.Run(func() {
+						argon2.IDKey([]byte("nonce"), salt, 1, 16*1024, 2, 32)
+					}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"fmt"
+
+	"captcha/internal/database"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// ChallengeCache keeps recently issued challenges in memory so verification
+// can skip the database lookup. It is local to one server instance.
+type ChallengeCache struct {
+	lru *lru.Cache[string, database.Challenge]
+}
+
+// NewChallengeCache returns nil, which caches nothing, when size is not
+// positive.
+func NewChallengeCache(size int) (*ChallengeCache, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+
+	c, err := lru.New[string, database.Challenge](size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create challenge cache: %w", err)
+	}
+	return &ChallengeCache{lru: c}, nil
+}
+
+// Get returns a copy, so callers may modify it without affecting the cache.
+func (c *ChallengeCache) Get(id string) (*database.Challenge, bool) {
+	if c == nil {
+		return nil, false
+	}
+	challenge, ok := c.lru.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return &challenge, true
+}
+
+func (c *ChallengeCache) Add(challenge *database.Challenge) {
+	if c == nil {
+		return
+	}
+	c.lru.Add(challenge.ID, *challenge)
+}
+
+// MarkSolved updates a cached challenge in place, so replays of it are
+// rejected without a database lookup.
+func (c *ChallengeCache) MarkSolved(id string) {
+	if c == nil {
+		return
+	}
+	challenge, ok := c.lru.Peek(id)
+	if !ok {
+		return
+	}
+	challenge.Solved = true
+	c.lru.Add(id, challenge)
+}
+
+func (c *ChallengeCache) Remove(id string) {
+	if c == nil {
+		return
+	}
+	c.lru.Remove(id)
+}
@@ -1,14 +1,19 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
+	DBDriver   string
 	DBHost     string
 	DBPort     int
 	DBName     string
@@ -16,45 +21,175 @@ type Config struct {
 	DBPassword string
 	DBSSLMode  string
 
-	ServerPort string
-	ServerHost string
+	DBSSLRootCert string
+	DBSSLCert     string
+	DBSSLKey      string
+
+	DBMaxOpenConns        int
+	DBMaxIdleConns        int
+	DBConnMaxLifetimeSecs int
+
+	DBCBFailureThreshold int
+	DBCBWindowSecs       int
+	DBCBOpenDurationSecs int
+
+	ServerPort     string
+	ServerHost     string
+	ServerTimezone string
+	ServerLocation *time.Location
+
+	TLSCertFile           string
+	TLSKeyFile            string
+	CertExpiryWarningDays int
 
 	Argon2Time         uint32
 	Argon2Memory       uint32
 	Argon2Threads      uint8
 	Argon2KeyLength    uint32
+	Argon2Variant      string
 	Argon2SaltLength   int
 	Argon2TargetPrefix string
 	Argon2MaxSolveTime int
 
+	Argon2ClientHashRate float64
+	ScryptClientHashRate float64
+
+	Argon2Calibrate             bool
+	Argon2CalibrateTargetMs     int
+	Argon2CalibrateMaxMemoryMiB int
+
+	PowAlgorithm    string
+	ScryptN         uint32
+	ScryptR         uint32
+	ScryptP         uint8
+	ScryptKeyLength uint32
+
+	Argon2MaxAllowedTime    uint32
+	Argon2MinAllowedMemory  uint32
+	Argon2MaxAllowedThreads uint8
+
+	Argon2WorkerPoolSize int
+
 	ChallengeExpiryMinutes        int
+	ChallengePoolSize             int
+	PoolSaturationAlertThreshold  float64
+	ChallengeCacheSize            int
+	ChallengeIDFormat             string
 	ChallengeCleanupIntervalMins  int
+	Retention                     RetentionPolicy
+	IncludeChallengeExpiry        bool
+	MaxChallengeExtensionMins     int
+	MaxTotalExtensions            int
+	ChallengeMaxAttempts          int
+	HoneypotBlockHours            int
+	MaxChallengesPerIPPerHour     int
+	ChallengeBatchMax             int
+
+	AllowMultipleValidNonces       bool
+	MaxValidSolutionsPerChallenge  int
 
 	AESKey                        string
 	AESKeyLength                  int
+	// AESKeys holds AES_KEY_v<n> by version; AES_KEY stands in for v1.
+	AESKeys                       map[uint8]string
+	AESActiveKeyVersion           int
 	FingerprintValidationTimeout  int
+	FingerprintAllowedPlatforms   []string
+	// Verifications whose fingerprint bot score exceeds this fail outright.
+	FingerprintRejectScoreThreshold float64
+
+	MinScreenWidth  int
+	MaxScreenWidth  int
+	MinScreenHeight int
+	MaxScreenHeight int
+	MinPixelRatio   float64
+	MaxPixelRatio   float64
 
 	WASMFingerprintFields []string
 	WASMObfuscationLevel  int
 
-	APIRateLimitRequests     int
-	APIRateLimitWindowMins   int
-	APICORSOrigins           []string
+	APIRateLimitRequests       int
+	APIRateLimitWindowMins     int
+	APICORSOrigins             []string
+	CORSMaxAgeSecs             int
+	CORSMaxAgeWithCredsSecs    int
+	ChallengeRateLimitRequests int
+	VerifyRateLimitRequests    int
+	APIResponseCase            string
+	DistributedRateLimit       bool
+	// TrustedProxies lists the peers whose X-Forwarded-For and X-Real-IP
+	// headers are believed; TrustedProxyNets is parsed from it.
+	TrustedProxies             []string
+	TrustedProxyNets           []*net.IPNet
+	// BackendCIDRs lists integrators' servers, whose verify calls never
+	// trigger honeypot blocking; BackendNets is parsed from it.
+	BackendCIDRs               []string
+	BackendNets                []*net.IPNet
 
 	CSRFTokenLength      int
 	SessionTimeoutMins   int
 
-	LogLevel string
-	LogFile  string
+	WebhookURL         string
+	WebhookSecret      string
+	WebhookTimeoutSecs int
+
+	AdminAPIKey       string
+	AdminPort         string
+	AdminPasswordHash string
+
+	RequestSigningKey string
+	WASMExpectedHash  string
+	EdgeHMACKey       string
+
+	SealedTokenPrivateKey         string
+	SealedTokenRecipientPublicKey string
+	SealedTokenTTLSeconds         int
 
-	DebugMode     bool
-	EnableMetrics bool
+	SolutionSigningKey string
+
+	VerifyTokenKey        string
+	VerifyTokenTTLSeconds int
+
+	LogLevel  string
+	LogFile   string
+	LogFormat string
+
+	DebugMode        bool
+	EnableMetrics    bool
+	MetricsAuthToken string
 }
 
+// RetentionPolicy sets how many days after it stops being useful each kind
+// of row is kept: solved challenges from solved_at, expired challenges from
+// expires_at and solutions from created_at. Zero deletes on the next run.
+type RetentionPolicy struct {
+	ChallengeSolvedRetentionDays  int
+	ChallengeExpiredRetentionDays int
+	SolutionValidRetentionDays    int
+	SolutionInvalidRetentionDays  int
+}
+
+// Load may be called again to reload; config.env and CONFIG_FILE are read
+// afresh each time.
 func Load() (*Config, error) {
-	godotenv.Load("config.env")
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	clearFileVars()
+	if vars, err := godotenv.Read("config.env"); err == nil {
+		setFileVars(vars)
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		vars, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		setFileVars(vars)
+	}
 
 	cfg := &Config{
+		DBDriver:   getEnvString("DB_DRIVER", "postgres"),
 		DBHost:     getEnvString("DB_HOST", "localhost"),
 		DBPort:     getEnvInt("DB_PORT", 5432),
 		DBName:     getEnvString("DB_NAME", "captcha_db"),
@@ -62,23 +197,93 @@ func Load() (*Config, error) {
 		DBPassword: getEnvString("DB_PASSWORD", ""),
 		DBSSLMode:  getEnvString("DB_SSL_MODE", "disable"),
 
-		ServerPort: getEnvString("SERVER_PORT", "8080"),
-		ServerHost: getEnvString("SERVER_HOST", "localhost"),
+		DBSSLRootCert: getEnvString("DB_SSL_ROOT_CERT", ""),
+		DBSSLCert:     getEnvString("DB_SSL_CERT", ""),
+		DBSSLKey:      getEnvString("DB_SSL_KEY", ""),
+
+		DBMaxOpenConns:        getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:        getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetimeSecs: getEnvInt("DB_CONN_MAX_LIFETIME_SECS", 300),
+
+		DBCBFailureThreshold: getEnvInt("DB_CB_FAILURE_THRESHOLD", 5),
+		DBCBWindowSecs:       getEnvInt("DB_CB_WINDOW_SECS", 30),
+		DBCBOpenDurationSecs: getEnvInt("DB_CB_OPEN_DURATION_SECS", 30),
+
+		ServerPort:     getEnvString("SERVER_PORT", "8080"),
+		ServerHost:     getEnvString("SERVER_HOST", "localhost"),
+		ServerTimezone: getEnvString("SERVER_TIMEZONE", "UTC"),
+
+		TLSCertFile:           getEnvString("TLS_CERT_FILE", ""),
+		TLSKeyFile:            getEnvString("TLS_KEY_FILE", ""),
+		CertExpiryWarningDays: getEnvInt("CERT_EXPIRY_WARNING_DAYS", 30),
 
 		Argon2Time:         uint32(getEnvInt("ARGON2_TIME", 3)),
 		Argon2Memory:       uint32(getEnvInt("ARGON2_MEMORY", 65536)),
 		Argon2Threads:      uint8(getEnvInt("ARGON2_THREADS", 1)),
 		Argon2KeyLength:    uint32(getEnvInt("ARGON2_KEY_LENGTH", 32)),
+		Argon2Variant:      getEnvString("ARGON2_VARIANT", "id"),
 		Argon2SaltLength:   getEnvInt("ARGON2_SALT_LENGTH", 16),
 		Argon2TargetPrefix: getEnvString("ARGON2_TARGET_PREFIX", "000"),
 		Argon2MaxSolveTime: getEnvInt("ARGON2_MAX_SOLVE_TIME", 6),
 
+		Argon2ClientHashRate: getEnvFloat("ARGON2_CLIENT_HASH_RATE", 10),
+		ScryptClientHashRate: getEnvFloat("SCRYPT_CLIENT_HASH_RATE", 20),
+
+		Argon2Calibrate:             getEnvBool("ARGON2_CALIBRATE", false),
+		Argon2CalibrateTargetMs:     getEnvInt("ARGON2_CALIBRATE_TARGET_MS", 250),
+		Argon2CalibrateMaxMemoryMiB: getEnvInt("ARGON2_CALIBRATE_MAX_MEMORY_MIB", 256),
+
+		PowAlgorithm:    getEnvString("POW_ALGORITHM", "argon2id"),
+		ScryptN:         uint32(getEnvInt("SCRYPT_N", 16384)),
+		ScryptR:         uint32(getEnvInt("SCRYPT_R", 8)),
+		ScryptP:         uint8(getEnvInt("SCRYPT_P", 1)),
+		ScryptKeyLength: uint32(getEnvInt("SCRYPT_KEY_LENGTH", 32)),
+
+		Argon2MaxAllowedTime:    uint32(getEnvInt("MAX_ALLOWED_TIME", 10)),
+		Argon2MinAllowedMemory:  uint32(getEnvInt("MIN_ALLOWED_MEMORY", 8192)),
+		Argon2MaxAllowedThreads: uint8(getEnvInt("MAX_ALLOWED_THREADS", 16)),
+
+		Argon2WorkerPoolSize: getEnvInt("ARGON2_WORKER_POOL_SIZE", defaultWorkerPoolSize()),
+
 		ChallengeExpiryMinutes:       getEnvInt("CHALLENGE_EXPIRY_MINUTES", 5),
+		ChallengePoolSize:            getEnvInt("CHALLENGE_POOL_SIZE", 50),
+		PoolSaturationAlertThreshold: getEnvFloat("POOL_SATURATION_ALERT_THRESHOLD", 20),
+		ChallengeCacheSize:           getEnvInt("CHALLENGE_CACHE_SIZE", 1000),
+		ChallengeIDFormat:            getEnvString("CHALLENGE_ID_FORMAT", "hex"),
 		ChallengeCleanupIntervalMins: getEnvInt("CHALLENGE_CLEANUP_INTERVAL_MINUTES", 10),
+		Retention: RetentionPolicy{
+			ChallengeSolvedRetentionDays:  getEnvInt("RETENTION_CHALLENGE_SOLVED_DAYS", 7),
+			ChallengeExpiredRetentionDays: getEnvInt("RETENTION_CHALLENGE_EXPIRED_DAYS", 0),
+			SolutionValidRetentionDays:    getEnvInt("RETENTION_SOLUTION_VALID_DAYS", 1),
+			SolutionInvalidRetentionDays:  getEnvInt("RETENTION_SOLUTION_INVALID_DAYS", 1),
+		},
+		IncludeChallengeExpiry:       getEnvBool("INCLUDE_CHALLENGE_EXPIRY", true),
+		MaxChallengeExtensionMins:    getEnvInt("MAX_CHALLENGE_EXTENSION_MINS", 10),
+		MaxTotalExtensions:           getEnvInt("MAX_TOTAL_EXTENSIONS", 3),
+		ChallengeMaxAttempts:         getEnvInt("CHALLENGE_MAX_ATTEMPTS", 10),
+		HoneypotBlockHours:           getEnvInt("HONEYPOT_BLOCK_HOURS", 24),
+		MaxChallengesPerIPPerHour:    getEnvInt("MAX_CHALLENGES_PER_IP_PER_HOUR", 100),
+		ChallengeBatchMax:            getEnvInt("CHALLENGE_BATCH_MAX", 10),
+
+		AllowMultipleValidNonces:      getEnvBool("ALLOW_MULTIPLE_VALID_NONCES", false),
+		MaxValidSolutionsPerChallenge: getEnvInt("MAX_VALID_SOLUTIONS_PER_CHALLENGE", 1),
 
 		AESKey:                       getEnvString("AES_KEY", ""),
 		AESKeyLength:                 getEnvInt("AES_KEY_LENGTH", 32),
+		AESActiveKeyVersion:          getEnvInt("AES_ACTIVE_KEY_VERSION", 1),
 		FingerprintValidationTimeout: getEnvInt("FINGERPRINT_VALIDATION_TIMEOUT", 30),
+		FingerprintAllowedPlatforms: getEnvStringSlice("FINGERPRINT_ALLOWED_PLATFORMS", []string{
+			"Win32", "MacIntel", "Linux x86_64", "Linux i686",
+			"iPhone", "iPad", "Android", "X11",
+		}),
+		FingerprintRejectScoreThreshold: getEnvFloat("FINGERPRINT_REJECT_SCORE_THRESHOLD", 0.7),
+
+		MinScreenWidth:  getEnvInt("MIN_SCREEN_WIDTH", 100),
+		MaxScreenWidth:  getEnvInt("MAX_SCREEN_WIDTH", 10000),
+		MinScreenHeight: getEnvInt("MIN_SCREEN_HEIGHT", 100),
+		MaxScreenHeight: getEnvInt("MAX_SCREEN_HEIGHT", 10000),
+		MinPixelRatio:   getEnvFloat("MIN_PIXEL_RATIO", 0.5),
+		MaxPixelRatio:   getEnvFloat("MAX_PIXEL_RATIO", 5.0),
 
 		WASMFingerprintFields: getEnvStringSlice("WASM_FINGERPRINT_FIELDS", []string{
 			"userAgent", "language", "platform", "hardwareConcurrency", "maxTouchPoints",
@@ -91,19 +296,228 @@ func Load() (*Config, error) {
 		APIRateLimitWindowMins: getEnvInt("API_RATE_LIMIT_WINDOW_MINUTES", 1),
 		APICORSOrigins:         getEnvStringSlice("API_CORS_ORIGINS", []string{"*"}),
 
+		CORSMaxAgeSecs:          getEnvInt("CORS_MAX_AGE_SECS", 86400),
+		CORSMaxAgeWithCredsSecs: getEnvInt("ACCESS_CONTROL_MAX_AGE_WITH_CREDENTIALS", 3600),
+
+		ChallengeRateLimitRequests: getEnvInt("CHALLENGE_RATE_LIMIT_REQUESTS", 30),
+		VerifyRateLimitRequests:    getEnvInt("VERIFY_RATE_LIMIT_REQUESTS", 10),
+		APIResponseCase:            getEnvString("API_RESPONSE_CASE", "camelCase"),
+		DistributedRateLimit:       getEnvBool("DISTRIBUTED_RATE_LIMIT", false),
+		TrustedProxies:             getEnvStringSlice("TRUSTED_PROXIES", nil),
+		BackendCIDRs:               getEnvStringSlice("BACKEND_CIDRS", nil),
+
 		CSRFTokenLength:    getEnvInt("CSRF_TOKEN_LENGTH", 32),
 		SessionTimeoutMins: getEnvInt("SESSION_TIMEOUT_MINUTES", 30),
 
-		LogLevel: getEnvString("LOG_LEVEL", "info"),
-		LogFile:  getEnvString("LOG_FILE", "captcha.log"),
+		WebhookURL:         getEnvString("WEBHOOK_URL", ""),
+		WebhookSecret:      getEnvString("WEBHOOK_SECRET", ""),
+		WebhookTimeoutSecs: getEnvInt("WEBHOOK_TIMEOUT_SECS", 5),
+
+		AdminAPIKey:       getEnvString("ADMIN_API_KEY", ""),
+		AdminPort:         getEnvString("ADMIN_PORT", ""),
+		AdminPasswordHash: getEnvString("ADMIN_PASSWORD_HASH", ""),
+
+		RequestSigningKey: getEnvString("REQUEST_SIGNING_KEY", ""),
+		WASMExpectedHash:  getEnvString("WASM_EXPECTED_HASH", ""),
+		EdgeHMACKey:       getEnvString("EDGE_HMAC_KEY", ""),
+
+		SealedTokenPrivateKey:         getEnvString("SEALED_TOKEN_PRIVATE_KEY", ""),
+		SealedTokenRecipientPublicKey: getEnvString("SEALED_TOKEN_RECIPIENT_PUBLIC_KEY", ""),
+		SealedTokenTTLSeconds:         getEnvInt("SEALED_TOKEN_TTL_SECONDS", 300),
+
+		SolutionSigningKey: getEnvString("SOLUTION_SIGNING_KEY", ""),
 
-		DebugMode:     getEnvBool("DEBUG_MODE", false),
-		EnableMetrics: getEnvBool("ENABLE_METRICS", true),
+		VerifyTokenKey:        getEnvString("VERIFY_TOKEN_KEY", ""),
+		VerifyTokenTTLSeconds: getEnvInt("VERIFY_TOKEN_TTL_SECONDS", 300),
+
+		LogLevel:  getEnvString("LOG_LEVEL", "info"),
+		LogFile:   getEnvString("LOG_FILE", "captcha.log"),
+		LogFormat: getEnvString("LOG_FORMAT", "text"),
+
+		DebugMode:        getEnvBool("DEBUG_MODE", false),
+		EnableMetrics:    getEnvBool("ENABLE_METRICS", true),
+		MetricsAuthToken: getEnvString("METRICS_AUTH_TOKEN", ""),
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
 
+// parseProxy accepts a CIDR range or a single address.
+func parseProxy(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network, nil
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address or CIDR range %q", entry)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// validate checks every setting and resolves the derived ones, reporting
+// all problems together as a *ValidationError.
+func (cfg *Config) validate() error {
+	errs := &ValidationError{}
+
+	loc, err := time.LoadLocation(cfg.ServerTimezone)
+	if err != nil {
+		errs.add("SERVER_TIMEZONE", "unknown timezone %q: %v", cfg.ServerTimezone, err)
+	}
+	cfg.ServerLocation = loc
+
+	cfg.TrustedProxyNets = nil
+	for _, entry := range cfg.TrustedProxies {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		network, err := parseProxy(entry)
+		if err != nil {
+			errs.add("TRUSTED_PROXIES", "%v", err)
+			continue
+		}
+		cfg.TrustedProxyNets = append(cfg.TrustedProxyNets, network)
+	}
+
+	cfg.BackendNets = nil
+	for _, entry := range cfg.BackendCIDRs {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		network, err := parseProxy(entry)
+		if err != nil {
+			errs.add("BACKEND_CIDRS", "%v", err)
+			continue
+		}
+		cfg.BackendNets = append(cfg.BackendNets, network)
+	}
+
+	switch cfg.DBDriver {
+	case "postgres":
+	case "mysql":
+		errs.add("DB_DRIVER", "mysql is not supported: queries use PostgreSQL-only JSONB operators, tsvector search and transaction-scoped advisory locks")
+	default:
+		errs.add("DB_DRIVER", "invalid value %q: must be postgres", cfg.DBDriver)
+	}
+
+	if cfg.DBPassword == "" && !cfg.DebugMode {
+		errs.add("DB_PASSWORD", "must be set unless DEBUG_MODE is enabled")
+	}
+
+	switch cfg.PowAlgorithm {
+	case "argon2id", "scrypt":
+	default:
+		errs.add("POW_ALGORITHM", "invalid value %q: must be argon2id or scrypt", cfg.PowAlgorithm)
+	}
+
+	switch cfg.Argon2Variant {
+	case "id", "i":
+	case "d":
+		errs.add("ARGON2_VARIANT", "d is not supported: golang.org/x/crypto/argon2 only implements argon2i and argon2id")
+	default:
+		errs.add("ARGON2_VARIANT", "invalid value %q: must be id or i", cfg.Argon2Variant)
+	}
+
+	if cfg.Argon2Memory < minArgon2Memory {
+		errs.add("ARGON2_MEMORY", "%d is below the minimum of %d KiB", cfg.Argon2Memory, minArgon2Memory)
+	}
+
+	if cfg.Argon2ClientHashRate <= 0 {
+		errs.add("ARGON2_CLIENT_HASH_RATE", "%g must be positive", cfg.Argon2ClientHashRate)
+	}
+	if cfg.ScryptClientHashRate <= 0 {
+		errs.add("SCRYPT_CLIENT_HASH_RATE", "%g must be positive", cfg.ScryptClientHashRate)
+	}
+
+	cfg.AESKeys, err = loadVersionedKeys(aesKeyVersionPrefix)
+	if err != nil {
+		errs.add(aesKeyVersionPrefix+"<n>", "%v", err)
+		cfg.AESKeys = make(map[uint8]string)
+	}
+	if _, ok := cfg.AESKeys[1]; !ok && cfg.AESKey != "" {
+		cfg.AESKeys[1] = cfg.AESKey
+	}
+	if cfg.AESActiveKeyVersion < 1 || cfg.AESActiveKeyVersion > 255 {
+		errs.add("AES_ACTIVE_KEY_VERSION", "%d is not between 1 and 255", cfg.AESActiveKeyVersion)
+	} else if _, ok := cfg.AESKeys[uint8(cfg.AESActiveKeyVersion)]; len(cfg.AESKeys) > 0 && !ok {
+		errs.add("AES_ACTIVE_KEY_VERSION", "%d has no %s%d", cfg.AESActiveKeyVersion, aesKeyVersionPrefix, cfg.AESActiveKeyVersion)
+	}
+
+	if cfg.PoolSaturationAlertThreshold < 0 || cfg.PoolSaturationAlertThreshold > 100 {
+		errs.add("POOL_SATURATION_ALERT_THRESHOLD", "%g is not a percentage between 0 and 100", cfg.PoolSaturationAlertThreshold)
+	}
+
+	if cfg.ChallengeBatchMax > cfg.ChallengeRateLimitRequests {
+		errs.add("CHALLENGE_BATCH_MAX", "%d exceeds CHALLENGE_RATE_LIMIT_REQUESTS (%d); larger batches could never pass the rate limit", cfg.ChallengeBatchMax, cfg.ChallengeRateLimitRequests)
+	}
+
+	if cfg.FingerprintRejectScoreThreshold < 0 || cfg.FingerprintRejectScoreThreshold > 1 {
+		errs.add("FINGERPRINT_REJECT_SCORE_THRESHOLD", "%g is not between 0 and 1", cfg.FingerprintRejectScoreThreshold)
+	}
+
+	if cfg.WebhookURL != "" && cfg.WebhookSecret == "" {
+		errs.add("WEBHOOK_SECRET", "required when WEBHOOK_URL is set")
+	}
+
+	switch cfg.ChallengeIDFormat {
+	case "hex", "uuid", "base58":
+	default:
+		errs.add("CHALLENGE_ID_FORMAT", "invalid value %q: must be hex, uuid or base58", cfg.ChallengeIDFormat)
+	}
+
+	switch cfg.LogFormat {
+	case "text", "json":
+	default:
+		errs.add("LOG_FORMAT", "invalid value %q: must be text or json", cfg.LogFormat)
+	}
+
+	switch strings.ToLower(cfg.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		errs.add("LOG_LEVEL", "invalid value %q: must be debug, info, warn or error", cfg.LogLevel)
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+const aesKeyVersionPrefix = "AES_KEY_v"
+
+// loadVersionedKeys collects prefix<n>=value variables, n from 1 to 255.
+func loadVersionedKeys(prefix string) (map[uint8]string, error) {
+	keys := make(map[uint8]string)
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		suffix, ok := strings.CutPrefix(name, prefix)
+		if !ok || value == "" {
+			continue
+		}
+		version, err := strconv.ParseUint(suffix, 10, 8)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid key variable %s: version must be between 1 and 255", name)
+		}
+		keys[uint8(version)] = value
+	}
+	return keys, nil
+}
+
+func defaultWorkerPoolSize() int {
+	if size := runtime.NumCPU() / 2; size > 0 {
+		return size
+	}
+	return 1
+}
+
 func getEnvString(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -120,6 +534,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
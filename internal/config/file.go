@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile flattens CONFIG_FILE into environment variables. Keys are the
+// variable names in any case; nested tables are joined with underscores, so
+// db: {host: x} becomes DB_HOST, and lists are joined with commas.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported CONFIG_FILE extension %q: must be .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CONFIG_FILE %s: %w", path, err)
+	}
+
+	vars := make(map[string]string)
+	if err := flatten("", values, vars); err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_FILE %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+var (
+	loadMu sync.Mutex
+	// fileVars are the variables Load set from config.env or CONFIG_FILE.
+	// They are cleared before every Load, so a reload sees edited files
+	// while the real environment keeps precedence.
+	fileVars = make(map[string]bool)
+)
+
+// setFileVars applies vars without overriding variables already set.
+func setFileVars(vars map[string]string) {
+	for name, value := range vars {
+		if _, set := os.LookupEnv(name); !set {
+			os.Setenv(name, value)
+			fileVars[name] = true
+		}
+	}
+}
+
+func clearFileVars() {
+	for name := range fileVars {
+		os.Unsetenv(name)
+		delete(fileVars, name)
+	}
+}
+
+func flatten(prefix string, values map[string]interface{}, vars map[string]string) error {
+	for key, value := range values {
+		name := strings.ToUpper(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(name, v, vars); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				s, err := scalar(name, item)
+				if err != nil {
+					return err
+				}
+				items[i] = s
+			}
+			vars[name] = strings.Join(items, ",")
+		default:
+			s, err := scalar(name, v)
+			if err != nil {
+				return err
+			}
+			vars[name] = s
+		}
+	}
+	return nil
+}
+
+func scalar(name string, value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("%s: nested value not allowed here", name)
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import "reflect"
+
+// startupSettings are read once when the server starts, to open the
+// database, bind listeners, load keys or size pools, so reloading them has
+// no effect until a restart. Everything else is read per request.
+var startupSettings = []struct {
+	field string
+	name  string
+}{
+	{"DBDriver", "DB_DRIVER"},
+	{"DBHost", "DB_HOST"},
+	{"DBPort", "DB_PORT"},
+	{"DBName", "DB_NAME"},
+	{"DBUser", "DB_USER"},
+	{"DBPassword", "DB_PASSWORD"},
+	{"DBSSLMode", "DB_SSL_MODE"},
+	{"DBSSLRootCert", "DB_SSL_ROOT_CERT"},
+	{"DBSSLCert", "DB_SSL_CERT"},
+	{"DBSSLKey", "DB_SSL_KEY"},
+	{"DBMaxOpenConns", "DB_MAX_OPEN_CONNS"},
+	{"DBMaxIdleConns", "DB_MAX_IDLE_CONNS"},
+	{"DBConnMaxLifetimeSecs", "DB_CONN_MAX_LIFETIME_SECS"},
+	{"DBCBFailureThreshold", "DB_CB_FAILURE_THRESHOLD"},
+	{"DBCBWindowSecs", "DB_CB_WINDOW_SECS"},
+	{"DBCBOpenDurationSecs", "DB_CB_OPEN_DURATION_SECS"},
+	{"ChallengeMaxAttempts", "CHALLENGE_MAX_ATTEMPTS"},
+	{"MaxTotalExtensions", "MAX_TOTAL_EXTENSIONS"},
+	{"ServerPort", "SERVER_PORT"},
+	{"ServerHost", "SERVER_HOST"},
+	{"AdminPort", "ADMIN_PORT"},
+	{"TLSCertFile", "TLS_CERT_FILE"},
+	{"TLSKeyFile", "TLS_KEY_FILE"},
+	{"AESKeys", "AES_KEY_v<n>"},
+	{"AESActiveKeyVersion", "AES_ACTIVE_KEY_VERSION"},
+	{"SealedTokenPrivateKey", "SEALED_TOKEN_PRIVATE_KEY"},
+	{"SealedTokenRecipientPublicKey", "SEALED_TOKEN_RECIPIENT_PUBLIC_KEY"},
+	{"SealedTokenTTLSeconds", "SEALED_TOKEN_TTL_SECONDS"},
+	{"SolutionSigningKey", "SOLUTION_SIGNING_KEY"},
+	{"VerifyTokenKey", "VERIFY_TOKEN_KEY"},
+	{"VerifyTokenTTLSeconds", "VERIFY_TOKEN_TTL_SECONDS"},
+	{"EdgeHMACKey", "EDGE_HMAC_KEY"},
+	{"RequestSigningKey", "REQUEST_SIGNING_KEY"},
+	{"WebhookURL", "WEBHOOK_URL"},
+	{"WebhookSecret", "WEBHOOK_SECRET"},
+	{"WebhookTimeoutSecs", "WEBHOOK_TIMEOUT_SECS"},
+	{"APIRateLimitRequests", "API_RATE_LIMIT_REQUESTS"},
+	{"APIRateLimitWindowMins", "API_RATE_LIMIT_WINDOW_MINUTES"},
+	{"ChallengeRateLimitRequests", "CHALLENGE_RATE_LIMIT_REQUESTS"},
+	{"VerifyRateLimitRequests", "VERIFY_RATE_LIMIT_REQUESTS"},
+	{"DistributedRateLimit", "DISTRIBUTED_RATE_LIMIT"},
+	{"CORSMaxAgeSecs", "CORS_MAX_AGE_SECS"},
+	{"APIResponseCase", "API_RESPONSE_CASE"},
+	{"ChallengePoolSize", "CHALLENGE_POOL_SIZE"},
+	{"PoolSaturationAlertThreshold", "POOL_SATURATION_ALERT_THRESHOLD"},
+	{"ChallengeCacheSize", "CHALLENGE_CACHE_SIZE"},
+	{"ChallengeIDFormat", "CHALLENGE_ID_FORMAT"},
+	{"ChallengeCleanupIntervalMins", "CHALLENGE_CLEANUP_INTERVAL_MINUTES"},
+	{"Argon2WorkerPoolSize", "ARGON2_WORKER_POOL_SIZE"},
+	{"Argon2Calibrate", "ARGON2_CALIBRATE"},
+	{"EnableMetrics", "ENABLE_METRICS"},
+	{"MetricsAuthToken", "METRICS_AUTH_TOKEN"},
+	{"LogLevel", "LOG_LEVEL"},
+	{"LogFormat", "LOG_FORMAT"},
+}
+
+// RestartRequired names the startup-only settings that differ between
+// current and next.
+func RestartRequired(current, next *Config) []string {
+	var changed []string
+	cur, nxt := reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem()
+	for _, s := range startupSettings {
+		if !reflect.DeepEqual(cur.FieldByName(s.field).Interface(), nxt.FieldByName(s.field).Interface()) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
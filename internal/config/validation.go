@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError names the environment variable, or config file key, at fault.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists every problem found, so a deployment can be fixed
+// in one pass rather than one restart per mistake.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		problems[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// minArgon2Memory is the smallest ARGON2_MEMORY in KiB that still makes
+// each hash cost a meaningful amount of memory.
+const minArgon2Memory = 8192
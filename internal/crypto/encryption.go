@@ -8,17 +8,39 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
 )
 
+type RandReader interface {
+	Read([]byte) (int, error)
+}
+
+var randReader RandReader = rand.Reader
+
+func SetRandReader(r io.Reader) {
+	if r == nil {
+		randReader = rand.Reader
+		return
+	}
+	randReader = r
+}
+
 func GenerateAESKey() ([]byte, error) {
 	key := make([]byte, 32)
-	if _, err := rand.Read(key); err != nil {
+	if _, err := io.ReadFull(randReader, key); err != nil {
 		return nil, fmt.Errorf("failed to generate AES key: %w", err)
 	}
 	return key, nil
 }
 
-func Encrypt(plaintext []byte, key []byte) (string, error) {
+// Encrypt seals plaintext with the active key and prefixes the key version,
+// so the result reads version || nonce || ciphertext before base64.
+func Encrypt(plaintext []byte, keys *KeyStore) (string, error) {
+	version, key, err := keys.Active()
+	if err != nil {
+		return "", err
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to create cipher: %w", err)
@@ -30,20 +52,46 @@ func Encrypt(plaintext []byte, key []byte) (string, error) {
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	if _, err := io.ReadFull(randReader, nonce); err != nil {
 		return "", fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := append([]byte{version}, nonce...)
+	ciphertext = gcm.Seal(ciphertext, nonce, plaintext, nil)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-func Decrypt(ciphertextBase64 string, key []byte) ([]byte, error) {
+// Decrypt opens a ciphertext from Encrypt with the key its version byte
+// names. Untagged ciphertexts from WASM builds that predate key versions
+// are tried against v1 when the tagged form does not open.
+func Decrypt(ciphertextBase64 string, keys *KeyStore) ([]byte, error) {
 	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextBase64)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode base64: %w", err)
 	}
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	key, tagged := keys.Key(ciphertext[0])
+	if tagged {
+		plaintext, err := open(ciphertext[1:], key)
+		if err == nil {
+			return plaintext, nil
+		}
+	}
+
+	legacyKey, ok := keys.Key(1)
+	if !ok {
+		if !tagged {
+			return nil, fmt.Errorf("unknown AES key version %d", ciphertext[0])
+		}
+		return nil, fmt.Errorf("failed to decrypt")
+	}
+	return open(ciphertext, legacyKey)
+}
 
+func open(ciphertext []byte, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
@@ -80,9 +128,32 @@ func HashData(data []byte) []byte {
 	return hash[:]
 }
 
+func ShannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	total := float64(len(data))
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / total
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
 func GenerateRandomBytes(length int) ([]byte, error) {
 	bytes := make([]byte, length)
-	if _, err := rand.Read(bytes); err != nil {
+	if _, err := io.ReadFull(randReader, bytes); err != nil {
 		return nil, fmt.Errorf("failed to generate random bytes: %w", err)
 	}
 	return bytes, nil
@@ -0,0 +1,24 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// GenerateExpirySignature signs a challenge's expiry so an edge node holding
+// the same key can check it without a database lookup.
+func GenerateExpirySignature(id string, expiresAt time.Time, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "|" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyExpirySignature only authenticates the pair; callers still compare
+// expiresAt against their own clock.
+func VerifyExpirySignature(id string, expiresAt time.Time, sig string, key []byte) bool {
+	expected := GenerateExpirySignature(id, expiresAt, key)
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
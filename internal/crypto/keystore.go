@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+)
+
+// KeyStore holds the AES keys fingerprints may be encrypted with, by the
+// version byte that tags each ciphertext. New ciphertexts use the active
+// version; retired versions stay loaded until no client still uses them.
+type KeyStore struct {
+	keys   map[uint8][]byte
+	active uint8
+}
+
+func NewKeyStore(active uint8) *KeyStore {
+	return &KeyStore{keys: make(map[uint8][]byte), active: active}
+}
+
+func (ks *KeyStore) Add(version uint8, key []byte) error {
+	if version == 0 {
+		return fmt.Errorf("AES key version must be between 1 and 255")
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("AES key v%d must be exactly 32 bytes, got %d bytes", version, len(key))
+	}
+	ks.keys[version] = key
+	return nil
+}
+
+func (ks *KeyStore) Key(version uint8) ([]byte, bool) {
+	key, ok := ks.keys[version]
+	return key, ok
+}
+
+// Active returns the version and key new ciphertexts are encrypted with.
+func (ks *KeyStore) Active() (uint8, []byte, error) {
+	key, ok := ks.keys[ks.active]
+	if !ok {
+		return 0, nil, fmt.Errorf("active AES key v%d is not loaded", ks.active)
+	}
+	return ks.active, key, nil
+}
+
+// Versions lists the loaded key versions in ascending order.
+func (ks *KeyStore) Versions() []uint8 {
+	versions := make([]uint8, 0, len(ks.keys))
+	for version := range ks.keys {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
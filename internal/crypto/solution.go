@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+func solutionDigest(challengeID, solutionID, clientIP, fingerprintHash string, solvedAt time.Time) []byte {
+	sum := sha256.Sum256([]byte(challengeID + solutionID + clientIP + fingerprintHash + strconv.FormatInt(solvedAt.Unix(), 10)))
+	return sum[:]
+}
+
+// SignSolution returns a detached base64 Ed25519 signature over a solved
+// challenge, letting an application server check a verify response against
+// the published public key without calling back.
+func SignSolution(privateKey ed25519.PrivateKey, challengeID, solutionID, clientIP, fingerprintHash string, solvedAt time.Time) string {
+	sig := ed25519.Sign(privateKey, solutionDigest(challengeID, solutionID, clientIP, fingerprintHash, solvedAt))
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func VerifySolutionSignature(publicKey []byte, signature, challengeID, solutionID, clientIP, fingerprintHash string, solvedAt time.Time) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(publicKey, solutionDigest(challengeID, solutionID, clientIP, fingerprintHash, solvedAt), sig)
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrCircuitOpen = errors.New("database circuit breaker open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker stops sending queries to a database that keeps failing.
+// After threshold consecutive failures within window it opens and rejects
+// calls with ErrCircuitOpen for openDuration, then lets a single probe
+// through; the probe's outcome closes or reopens it.
+type CircuitBreaker struct {
+	threshold    int
+	window       time.Duration
+	openDuration time.Duration
+
+	mu           sync.Mutex
+	state        circuitState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+}
+
+// NewCircuitBreaker returns nil, which never trips, when threshold is not
+// positive.
+func NewCircuitBreaker(threshold int, window, openDuration time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{
+		threshold:    threshold,
+		window:       window,
+		openDuration: openDuration,
+	}
+}
+
+// Allow reports ErrCircuitOpen when the call must not reach the database.
+// A nil error obliges the caller to Record the outcome.
+func (cb *CircuitBreaker) Allow() error {
+	if cb == nil {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if time.Since(cb.openedAt) < cb.openDuration {
+			return ErrCircuitOpen
+		}
+		cb.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// The probe is still in flight.
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+func (cb *CircuitBreaker) Record(err error) {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !isConnectionFailure(err) {
+		cb.state = circuitClosed
+		cb.failures = 0
+		return
+	}
+
+	now := time.Now()
+	if cb.state == circuitHalfOpen {
+		cb.state = circuitOpen
+		cb.openedAt = now
+		return
+	}
+
+	if cb.failures == 0 || now.Sub(cb.firstFailure) > cb.window {
+		cb.failures = 0
+		cb.firstFailure = now
+	}
+	cb.failures++
+	if cb.failures >= cb.threshold {
+		cb.state = circuitOpen
+		cb.openedAt = now
+		cb.failures = 0
+	}
+}
+
+// Open is also true while a half-open probe is pending.
+func (cb *CircuitBreaker) Open() bool {
+	if cb == nil {
+		return false
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state != circuitClosed
+}
+
+// isConnectionFailure ignores missing rows and errors PostgreSQL reported
+// about the query itself, such as constraint violations, since the server
+// answered them. Connection, resource and shutdown classes still count.
+func isConnectionFailure(err error) bool {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57":
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// breakerConn routes the queries DB issues through a CircuitBreaker. Ping,
+// Stats and pool settings go straight to the embedded *sql.DB so readiness
+// checks still see the real database.
+type breakerConn struct {
+	*sql.DB
+	cb *CircuitBreaker
+}
+
+func (c *breakerConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if err := c.cb.Allow(); err != nil {
+		return nil, err
+	}
+	result, err := c.DB.Exec(query, args...)
+	c.cb.Record(err)
+	return result, err
+}
+
+func (c *breakerConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if err := c.cb.Allow(); err != nil {
+		return nil, err
+	}
+	rows, err := c.DB.Query(query, args...)
+	c.cb.Record(err)
+	return rows, err
+}
+
+func (c *breakerConn) QueryRow(query string, args ...interface{}) rowScanner {
+	if err := c.cb.Allow(); err != nil {
+		return errRow{err}
+	}
+	return breakerRow{c.DB.QueryRow(query, args...), c.cb}
+}
+
+func (c *breakerConn) Begin() (*sql.Tx, error) {
+	if err := c.cb.Allow(); err != nil {
+		return nil, err
+	}
+	tx, err := c.DB.Begin()
+	c.cb.Record(err)
+	return tx, err
+}
+
+// breakerRow records the outcome at Scan, where *sql.Row reports errors.
+type breakerRow struct {
+	row *sql.Row
+	cb  *CircuitBreaker
+}
+
+func (r breakerRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	r.cb.Record(err)
+	return err
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
@@ -16,8 +16,34 @@ type Challenge struct {
 	ExpiresAt  time.Time `db:"expires_at" json:"expiresAt"`
 	Solved     bool      `db:"solved" json:"solved"`
 	SolvedAt   *time.Time `db:"solved_at" json:"solvedAt,omitempty"`
+
+	ParamsDigest string `db:"params_digest" json:"paramsDigest"`
+	Type         string `db:"challenge_type" json:"type"`
+
+	ExpirySignature string `db:"-" json:"expirySignature,omitempty"`
+
+	ClientIP string `db:"client_ip" json:"clientIP"`
+
+	Algorithm string `db:"algorithm" json:"algorithm"`
+
+	SessionTokenHash string `db:"session_token_hash" json:"-"`
+
+	Variant string `db:"variant" json:"variant"`
+
+	RequestID string `db:"request_id" json:"requestId,omitempty"`
 }
 
+const (
+	ChallengeTypeStandard = "standard"
+	ChallengeTypeHoneypot = "honeypot"
+)
+
+const (
+	MaxMetadataKeys        = 20
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 256
+)
+
 type Solution struct {
 	ID          string    `db:"id" json:"id"`
 	ChallengeID string    `db:"challenge_id" json:"challengeId"`
@@ -28,6 +54,11 @@ type Solution struct {
 	UserAgent   string    `db:"user_agent" json:"userAgent"`
 	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
 	Valid       bool      `db:"valid" json:"valid"`
+
+	PlatformNormalized string `db:"platform_normalized" json:"platformNormalized"`
+	FingerprintHash    string `db:"fingerprint_hash" json:"fingerprintHash"`
+
+	RequestID string `db:"request_id" json:"requestId,omitempty"`
 }
 
 type FingerprintData struct {
@@ -43,4 +74,132 @@ type FingerprintData struct {
 	DoNotTrack                  string `json:"doNotTrack"`
 	ScreenResolution            string `json:"screenResolution"`
 	AvailableScreenResolution   string `json:"availableScreenResolution"`
-} 
\ No newline at end of file
+	ShadowDOMDepth              int    `json:"shadowDOMDepth"`
+	CustomElementCount          int    `json:"customElementCount"`
+	TimerGranularityUs          float64 `json:"timerGranularityUs"`
+	ScreenOrientation           string `json:"screenOrientation"`
+	ScreenOrientationType       string `json:"screenOrientationType"`
+	WASMInstantiationTimeMs     int    `json:"wasmInstantiationTimeMs"`
+	GPUMaxTextureSize           *int   `json:"gpuMaxTextureSize"`
+	PointerLockAvailable        bool   `json:"pointerLockAvailable"`
+	FullscreenAvailable         bool   `json:"fullscreenAvailable"`
+	IdleCallbackLatencyMs       *int   `json:"idleCallbackLatencyMs"`
+	MediaQueryFingerprint       string `json:"mediaQueryFingerprint"`
+	BroadcastChannelAvailable   bool   `json:"broadcastChannelAvailable"`
+	CrossTabCommunicationActive bool   `json:"crossTabCommunicationActive"`
+	FingerprintResistanceDetected bool `json:"fingerprintResistanceDetected"`
+	CSSAnimationTimingPrecisionUs *int `json:"cssAnimationTimingPrecisionUs"`
+	StorageQuotaGB              *float64 `json:"storageQuotaGB"`
+	StorageUsageMB              *float64 `json:"storageUsageMB"`
+	SpeechVoiceCount            int    `json:"speechVoiceCount"`
+	SpeechVoiceHash             string `json:"speechVoiceHash"`
+	ServiceWorkerAvailable      bool   `json:"serviceWorkerAvailable"`
+	ServiceWorkerRegistered     bool   `json:"serviceWorkerRegistered"`
+	GPUTier                     string `json:"gpuTier"`
+	PageAgeSeconds              int    `json:"pageAgeSeconds"`
+	SupportedMIMEHash           string `json:"supportedMIMEHash"`
+	CacheAPIAvailable           bool   `json:"cacheAPIAvailable"`
+	EstimatedCacheLatencyMs     *int   `json:"estimatedCacheLatencyMs"`
+	CSSCustomPropertiesSupported bool  `json:"cssCustomPropertiesSupported"`
+	CSSGridSupported            bool   `json:"cssGridSupported"`
+	CSSFlexSupported            bool   `json:"cssFlexSupported"`
+	ClipboardContentHash        *string `json:"clipboardContentHash"`
+	CanvasHash                  string `json:"canvasHash"`
+	WebGLRenderer               string `json:"webglRenderer"`
+	WebGLVendor                 string `json:"webglVendor"`
+	WebGLExtensionCount         int    `json:"webglExtensionCount"`
+	WebDriver                   bool     `json:"webDriver"`
+	Languages                   []string `json:"languages"`
+	PluginCount                 int      `json:"pluginCount"`
+	RTCLocalIPHash              string   `json:"rtcLocalIPHash"`
+} 
+
+// FingerprintFailure identifies one way a fingerprint field can fail.
+type FingerprintFailure struct {
+	Field  string
+	Reason string
+}
+
+type FingerprintFailureStat struct {
+	Field  string  `json:"field"`
+	Reason string  `json:"reason"`
+	Count  int64   `json:"count"`
+	Share  float64 `json:"share"`
+}
+
+type DifficultySnapshot struct {
+	Timestamp     time.Time `db:"timestamp" json:"timestamp"`
+	PrefixLength  int       `db:"prefix_length" json:"prefixLength"`
+	Memory        uint32    `db:"memory" json:"memory"`
+	TimeParam     uint32    `db:"time_param" json:"timeParam"`
+	SolveRatePct  float64   `db:"solve_rate_pct" json:"solveRatePct"`
+	MedianSolveMs int64     `db:"median_solve_ms" json:"medianSolveMs"`
+}
+
+// StatsFilter narrows statistics to challenges whose metadata contains
+// MetaKey set to MetaValue. The zero value matches every challenge.
+type StatsFilter struct {
+	MetaKey   string
+	MetaValue string
+}
+
+type Stats struct {
+	ChallengesGenerated int64   `json:"challengesGenerated"`
+	ChallengesSolved    int64   `json:"challengesSolved"`
+	SolutionsSubmitted  int64   `json:"solutionsSubmitted"`
+	ValidSolutions      int64   `json:"validSolutions"`
+	SolutionValidRate   float64 `json:"solutionValidRate"`
+	AverageSolveMs      float64 `json:"averageSolveMs"`
+	UniqueIPs           int64   `json:"uniqueIPs"`
+
+	ChallengesGeneratedLast1h int64    `json:"challengesGeneratedLast1h"`
+	ChallengesSolvedLast1h    int64    `json:"challengesSolvedLast1h"`
+	TopUserAgents             []string `json:"topUserAgents"`
+
+	// Platforms counts submitted solutions by platform_normalized.
+	Platforms map[string]int64 `json:"platforms"`
+
+	Buckets []StatsBucket `json:"buckets,omitempty"`
+}
+
+// StatsBucket covers the challenges created in one DATE_TRUNC period.
+type StatsBucket struct {
+	Start               time.Time `json:"start"`
+	ChallengesGenerated int64     `json:"challengesGenerated"`
+	ChallengesSolved    int64     `json:"challengesSolved"`
+	AverageSolveMs      float64   `json:"averageSolveMs"`
+}
+
+type RiskScoreSample struct {
+	Score float64   `json:"score"`
+	At    time.Time `json:"at"`
+}
+
+type IPHistory struct {
+	IP                string             `json:"ip"`
+	ChallengesCreated int64              `json:"challengesCreated"`
+	ChallengesSolved  int64              `json:"challengesSolved"`
+	Solutions         []*Solution        `json:"solutions"`
+	NextCursor        string             `json:"nextCursor,omitempty"`
+	FirstSeen         *time.Time         `json:"firstSeen"`
+	LastSeen          *time.Time         `json:"lastSeen"`
+	RiskScores        []*RiskScoreSample `json:"riskScores"`
+}
+
+type ConfigAuditEntry struct {
+	ID          int64     `db:"id" json:"id"`
+	EventType   string    `db:"event_type" json:"eventType"`
+	OldKeyHash  string    `db:"old_key_hash" json:"oldKeyHash,omitempty"`
+	NewKeyHash  string    `db:"new_key_hash" json:"newKeyHash,omitempty"`
+	PerformedAt time.Time `db:"performed_at" json:"performedAt"`
+	Source      string    `db:"source" json:"source"`
+}
+
+type AuditEntry struct {
+	ID        int64     `db:"id" json:"id"`
+	EventType string    `db:"event_type" json:"eventType"`
+	ClientIP  string    `db:"client_ip" json:"clientIP"`
+	UserAgent string    `db:"user_agent" json:"userAgent"`
+	Metadata  string    `db:"metadata" json:"metadata"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"captcha/internal/config"
@@ -10,7 +16,7 @@ import (
 )
 
 type DB struct {
-	conn *sql.DB
+	conn *breakerConn
 	cfg  *config.Config
 }
 
@@ -18,6 +24,25 @@ func NewDB(cfg *config.Config) (*DB, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBSSLMode)
 
+	sslFiles := []struct {
+		param string
+		path  string
+	}{
+		{"sslrootcert", cfg.DBSSLRootCert},
+		{"sslcert", cfg.DBSSLCert},
+		{"sslkey", cfg.DBSSLKey},
+	}
+
+	for _, f := range sslFiles {
+		if f.path == "" {
+			continue
+		}
+		if err := checkReadable(f.path); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", f.param, err)
+		}
+		dsn += fmt.Sprintf(" %s=%s", f.param, f.path)
+	}
+
 	conn, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -27,8 +52,15 @@ func NewDB(cfg *config.Config) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	conn.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	conn.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeSecs) * time.Second)
+
+	cb := NewCircuitBreaker(cfg.DBCBFailureThreshold, time.Duration(cfg.DBCBWindowSecs)*time.Second,
+		time.Duration(cfg.DBCBOpenDurationSecs)*time.Second)
+
 	db := &DB{
-		conn: conn,
+		conn: &breakerConn{DB: conn, cb: cb},
 		cfg:  cfg,
 	}
 
@@ -39,6 +71,28 @@ func NewDB(cfg *config.Config) (*DB, error) {
 	return db, nil
 }
 
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (db *DB) Ping() error {
+	return db.conn.Ping()
+}
+
+func (db *DB) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
+// CircuitOpen reports whether queries are currently being rejected with
+// ErrCircuitOpen.
+func (db *DB) CircuitOpen() bool {
+	return db.conn.cb.Open()
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
@@ -73,6 +127,99 @@ func (db *DB) createTables() error {
 		`CREATE INDEX IF NOT EXISTS idx_challenges_solved ON challenges(solved)`,
 		`CREATE INDEX IF NOT EXISTS idx_solutions_challenge_id ON solutions(challenge_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_solutions_created_at ON solutions(created_at)`,
+		`ALTER TABLE solutions ADD COLUMN IF NOT EXISTS platform_normalized VARCHAR(16)`,
+		`CREATE INDEX IF NOT EXISTS idx_solutions_platform_normalized ON solutions(platform_normalized)`,
+		`ALTER TABLE solutions ADD COLUMN IF NOT EXISTS fingerprint_hash VARCHAR(64)`,
+		`CREATE INDEX IF NOT EXISTS idx_solutions_fingerprint_hash ON solutions(fingerprint_hash)`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS extension_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS params_digest VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS challenge_type VARCHAR(16) NOT NULL DEFAULT 'standard'`,
+		`CREATE TABLE IF NOT EXISTS ip_blocklist (
+			ip VARCHAR(45) PRIMARY KEY,
+			reason VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			event_type VARCHAR(64) NOT NULL,
+			client_ip VARCHAR(45) NOT NULL,
+			user_agent TEXT NOT NULL,
+			metadata TEXT NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_search ON audit_log
+			USING GIN (to_tsvector('english', client_ip || ' ' || user_agent || ' ' || metadata))`,
+		`CREATE TABLE IF NOT EXISTS config_audit (
+			id BIGSERIAL PRIMARY KEY,
+			event_type VARCHAR(64) NOT NULL,
+			old_key_hash VARCHAR(64) NOT NULL DEFAULT '',
+			new_key_hash VARCHAR(64) NOT NULL DEFAULT '',
+			performed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			source VARCHAR(64) NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_config_audit_performed_at ON config_audit(performed_at)`,
+		`CREATE TABLE IF NOT EXISTS rate_limit_entries (
+			key VARCHAR(128) NOT NULL,
+			ts TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_rate_limit_entries_key_ts ON rate_limit_entries(key, ts)`,
+		`CREATE TABLE IF NOT EXISTS fingerprint_failures (
+			field VARCHAR(64) NOT NULL,
+			reason VARCHAR(255) NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0,
+			day DATE NOT NULL DEFAULT CURRENT_DATE,
+			PRIMARY KEY (field, reason, day)
+		)`,
+		`CREATE TABLE IF NOT EXISTS difficulty_history (
+			timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			prefix_length INTEGER NOT NULL,
+			memory INTEGER NOT NULL,
+			time_param INTEGER NOT NULL,
+			solve_rate_pct DOUBLE PRECISION NOT NULL,
+			median_solve_ms BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_difficulty_history_timestamp ON difficulty_history(timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_challenges_metadata ON challenges USING GIN (metadata)`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS client_ip VARCHAR(45) NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_challenges_client_ip ON challenges(client_ip)`,
+		`CREATE INDEX IF NOT EXISTS idx_solutions_client_ip ON solutions(client_ip, created_at)`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS algorithm VARCHAR(16) NOT NULL DEFAULT 'argon2id'`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS attempt_count INTEGER NOT NULL DEFAULT 0`,
+		fmt.Sprintf(`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT %d`, db.cfg.ChallengeMaxAttempts),
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'challenges_attempt_limit') THEN
+				ALTER TABLE challenges ADD CONSTRAINT challenges_attempt_limit CHECK (attempt_count <= max_attempts);
+			END IF;
+		END $$`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS session_token_hash VARCHAR(64) NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_challenges_client_ip_created_at ON challenges(client_ip, created_at)`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS variant VARCHAR(4) NOT NULL DEFAULT 'id'`,
+		`DO $$
+		BEGIN
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_solutions_challenge_nonce ON solutions(challenge_id, nonce);
+		EXCEPTION WHEN unique_violation THEN
+			RAISE WARNING 'solutions has repeated nonces; idx_solutions_challenge_nonce will be retried after retention cleanup';
+		END $$`,
+		`ALTER TABLE challenges ADD COLUMN IF NOT EXISTS request_id VARCHAR(36)`,
+		`ALTER TABLE solutions ADD COLUMN IF NOT EXISTS request_id VARCHAR(36)`,
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+						   WHERE table_name = 'challenges' AND column_name = 'valid_count') THEN
+				ALTER TABLE challenges ADD COLUMN valid_count INTEGER NOT NULL DEFAULT 0;
+				UPDATE challenges c SET valid_count = s.n
+				FROM (SELECT challenge_id, COUNT(*) AS n FROM solutions WHERE valid = true GROUP BY challenge_id) s
+				WHERE c.id = s.challenge_id AND c.expires_at > NOW();
+			END IF;
+		END $$`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			name VARCHAR(64) PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)`,
 	}
 
 	for _, query := range queries {
@@ -85,26 +232,54 @@ func (db *DB) createTables() error {
 }
 
 func (db *DB) CreateChallenge(challenge *Challenge) error {
-	query := `INSERT INTO challenges (id, salt, difficulty, memory, threads, key_len, target, created_at, expires_at)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	query := `INSERT INTO challenges (id, salt, difficulty, memory, threads, key_len, target, created_at, expires_at, params_digest, challenge_type,
+			  client_ip, algorithm, max_attempts, session_token_hash, variant, request_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NULLIF($17, ''))`
 	
 	_, err := db.conn.Exec(query, challenge.ID, challenge.Salt, challenge.Difficulty,
 		challenge.Memory, challenge.Threads, challenge.KeyLen, challenge.Target,
-		challenge.CreatedAt, challenge.ExpiresAt)
+		challenge.CreatedAt, challenge.ExpiresAt, challenge.ParamsDigest, challenge.Type, challenge.ClientIP, challenge.Algorithm,
+		db.cfg.ChallengeMaxAttempts, challenge.SessionTokenHash, challenge.Variant, challenge.RequestID)
 	
 	return err
 }
 
-func (db *DB) GetChallenge(id string) (*Challenge, error) {
-	query := `SELECT id, salt, difficulty, memory, threads, key_len, target, created_at, expires_at, solved, solved_at
-			  FROM challenges WHERE id = $1`
-	
+// ClaimChallenge hands a pre-generated challenge to a client. It returns
+// false when the row is gone or was already claimed.
+func (db *DB) ClaimChallenge(challenge *Challenge) (bool, error) {
+	query := `UPDATE challenges SET client_ip = $2, session_token_hash = $3, created_at = $4, expires_at = $5,
+			  request_id = NULLIF($6, '')
+			  WHERE id = $1 AND client_ip = '' AND solved = false`
+
+	result, err := db.conn.Exec(query, challenge.ID, challenge.ClientIP, challenge.SessionTokenHash,
+		challenge.CreatedAt, challenge.ExpiresAt, challenge.RequestID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+const challengeColumns = `id, salt, difficulty, memory, threads, key_len, target, created_at, expires_at, solved, solved_at,
+			  params_digest, challenge_type, client_ip, algorithm, session_token_hash, COALESCE(variant, 'id')`
+
+func scanChallenge(row rowScanner) (*Challenge, error) {
 	challenge := &Challenge{}
-	err := db.conn.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&challenge.ID, &challenge.Salt, &challenge.Difficulty, &challenge.Memory,
 		&challenge.Threads, &challenge.KeyLen, &challenge.Target, &challenge.CreatedAt,
-		&challenge.ExpiresAt, &challenge.Solved, &challenge.SolvedAt,
+		&challenge.ExpiresAt, &challenge.Solved, &challenge.SolvedAt, &challenge.ParamsDigest,
+		&challenge.Type, &challenge.ClientIP, &challenge.Algorithm, &challenge.SessionTokenHash,
+		&challenge.Variant,
 	)
+	return challenge, err
+}
+
+func (db *DB) GetChallenge(id string) (*Challenge, error) {
+	query := `SELECT ` + challengeColumns + ` FROM challenges WHERE id = $1`
+	
+	challenge, err := scanChallenge(db.conn.QueryRow(query, id))
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -113,34 +288,284 @@ func (db *DB) GetChallenge(id string) (*Challenge, error) {
 	return challenge, err
 }
 
+func (db *DB) GetChallenges(ids []string) ([]*Challenge, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	query := `SELECT ` + challengeColumns + ` FROM challenges WHERE id IN (` + strings.Join(placeholders, ", ") + `)`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var challenges []*Challenge
+	for rows.Next() {
+		challenge, err := scanChallenge(rows)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, challenge)
+	}
+
+	return challenges, rows.Err()
+}
+
+// DeleteChallenges removes freshly issued challenges in one statement, for
+// rolling back a batch that could not be completed.
+func (db *DB) DeleteChallenges(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	_, err := db.conn.Exec(`DELETE FROM challenges WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	return err
+}
+
 func (db *DB) MarkChallengeSolved(id string) error {
 	query := `UPDATE challenges SET solved = true, solved_at = NOW() WHERE id = $1`
 	_, err := db.conn.Exec(query, id)
 	return err
 }
 
+// IncrementChallengeAttempts counts one verification attempt and returns
+// the new total. Once the limit is reached the update fails with the
+// challenges_attempt_limit check violation, which callers translate into a
+// typed error.
+func (db *DB) IncrementChallengeAttempts(id string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`UPDATE challenges SET attempt_count = attempt_count + 1 WHERE id = $1
+			  RETURNING attempt_count`, id).Scan(&count)
+	return count, err
+}
+
+// IsChallengeAttempted reports whether nonce was already submitted for the
+// challenge. Nonces are small counters, so they are only unique per
+// challenge.
+func (db *DB) IsChallengeAttempted(challengeID, nonce string) (bool, error) {
+	var exists bool
+	err := db.conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM solutions WHERE challenge_id = $1 AND nonce = $2)`,
+		challengeID, nonce).Scan(&exists)
+	return exists, err
+}
+
+func (db *DB) ExtendChallengeExpiry(id string, extraMinutes int) (*time.Time, error) {
+	query := `UPDATE challenges
+			  SET expires_at = expires_at + make_interval(mins => $1), extension_count = extension_count + 1
+			  WHERE id = $2 AND solved = false AND expires_at > NOW() AND extension_count < $3
+			  RETURNING expires_at`
+
+	var expiresAt time.Time
+	err := db.conn.QueryRow(query, extraMinutes, id, db.cfg.MaxTotalExtensions).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &expiresAt, nil
+}
+
+func (db *DB) UpdateChallengeMetadata(id string, meta map[string]string) (map[string]string, error) {
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE challenges SET metadata = metadata || $1::jsonb WHERE id = $2 RETURNING metadata`
+
+	var updatedJSON []byte
+	err = db.conn.QueryRow(query, string(metaJSON), id).Scan(&updatedJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated := make(map[string]string)
+	if err := json.Unmarshal(updatedJSON, &updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (db *DB) RevokeChallenge(id string) error {
+	query := `UPDATE challenges SET expires_at = NOW() WHERE id = $1 AND solved = false`
+	_, err := db.conn.Exec(query, id)
+	return err
+}
+
+// deviceFingerprint holds the fingerprint fields that stay the same across
+// solves on one device. Timings, page age, storage usage and zoom vary from
+// solve to solve and are left out.
+type deviceFingerprint struct {
+	UserAgent           string   `json:"userAgent"`
+	Platform            string   `json:"platform"`
+	Languages           []string `json:"languages"`
+	Timezone            string   `json:"timezone"`
+	HardwareConcurrency int      `json:"hardwareConcurrency"`
+	MaxTouchPoints      int      `json:"maxTouchPoints"`
+	ColorDepth          int      `json:"colorDepth"`
+	ScreenResolution    string   `json:"screenResolution"`
+	GPUMaxTextureSize   *int     `json:"gpuMaxTextureSize"`
+	GPUTier             string   `json:"gpuTier"`
+	WebGLRenderer       string   `json:"webglRenderer"`
+	WebGLVendor         string   `json:"webglVendor"`
+	WebGLExtensionCount int      `json:"webglExtensionCount"`
+	CanvasHash          string   `json:"canvasHash"`
+	SpeechVoiceHash     string   `json:"speechVoiceHash"`
+	SupportedMIMEHash   string   `json:"supportedMIMEHash"`
+	PluginCount         int      `json:"pluginCount"`
+}
+
+// FingerprintHash identifies the device behind a fingerprint, so repeat
+// solves from it share a hash. Fingerprints that do not parse are hashed
+// whole.
+func FingerprintHash(fingerprintJSON string) string {
+	subject := []byte(fingerprintJSON)
+
+	var fp FingerprintData
+	if err := json.Unmarshal(subject, &fp); err == nil {
+		stable, err := json.Marshal(deviceFingerprint{
+			UserAgent:           fp.UserAgent,
+			Platform:            fp.Platform,
+			Languages:           fp.Languages,
+			Timezone:            fp.Timezone,
+			HardwareConcurrency: fp.HardwareConcurrency,
+			MaxTouchPoints:      fp.MaxTouchPoints,
+			ColorDepth:          fp.ColorDepth,
+			ScreenResolution:    fp.ScreenResolution,
+			GPUMaxTextureSize:   fp.GPUMaxTextureSize,
+			GPUTier:             fp.GPUTier,
+			WebGLRenderer:       fp.WebGLRenderer,
+			WebGLVendor:         fp.WebGLVendor,
+			WebGLExtensionCount: fp.WebGLExtensionCount,
+			CanvasHash:          fp.CanvasHash,
+			SpeechVoiceHash:     fp.SpeechVoiceHash,
+			SupportedMIMEHash:   fp.SupportedMIMEHash,
+			PluginCount:         fp.PluginCount,
+		})
+		if err == nil {
+			subject = stable
+		}
+	}
+
+	hash := sha256.Sum256(subject)
+	return hex.EncodeToString(hash[:])
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func (db *DB) CreateSolution(solution *Solution) error {
-	query := `INSERT INTO solutions (id, challenge_id, nonce, hash, fingerprint, client_ip, user_agent, created_at, valid)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	return insertSolution(db.conn, solution)
+}
+
+// ErrValidSolutionCap is returned by CreateValidSolution once the challenge
+// has accepted its maximum number of valid solutions.
+var ErrValidSolutionCap = errors.New("challenge has no valid solutions left")
+
+// CreateValidSolution stores a valid solution only while the challenge has
+// fewer than maxValid of them, and returns the new count. The conditional
+// update holds the challenge's row lock until the insert commits, so
+// concurrent verifications cannot both take the last slot.
+func (db *DB) CreateValidSolution(solution *Solution, maxValid int) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(`UPDATE challenges SET valid_count = valid_count + 1
+			  WHERE id = $1 AND valid_count < $2 RETURNING valid_count`, solution.ChallengeID, maxValid).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, ErrValidSolutionCap
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertSolution(tx, solution); err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+// CountValidSolutions returns how many valid solutions the challenge has
+// accepted. It only reads the count, so use CreateValidSolution to enforce
+// the cap.
+func (db *DB) CountValidSolutions(challengeID string) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT valid_count FROM challenges WHERE id = $1`, challengeID).Scan(&count)
+	return count, err
+}
+
+func insertSolution(conn execer, solution *Solution) error {
+	solution.FingerprintHash = FingerprintHash(solution.Fingerprint)
+
+	query := `INSERT INTO solutions (id, challenge_id, nonce, hash, fingerprint, client_ip, user_agent, created_at, valid,
+			  platform_normalized, fingerprint_hash, request_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''))`
 	
-	_, err := db.conn.Exec(query, solution.ID, solution.ChallengeID, solution.Nonce,
+	_, err := conn.Exec(query, solution.ID, solution.ChallengeID, solution.Nonce,
 		solution.Hash, solution.Fingerprint, solution.ClientIP, solution.UserAgent,
-		solution.CreatedAt, solution.Valid)
+		solution.CreatedAt, solution.Valid, solution.PlatformNormalized, solution.FingerprintHash, solution.RequestID)
 	
 	return err
 }
 
-func (db *DB) GetSolution(id string) (*Solution, error) {
-	query := `SELECT id, challenge_id, nonce, hash, fingerprint, client_ip, user_agent, created_at, valid
-			  FROM solutions WHERE id = $1`
-	
+func (db *DB) CountChallengesFromIP(ip string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM challenges WHERE client_ip = $1 AND created_at >= $2`
+
+	var count int
+	err := db.conn.QueryRow(query, ip, since).Scan(&count)
+	return count, err
+}
+
+const solutionColumns = `id, challenge_id, nonce, hash, fingerprint, client_ip, user_agent, created_at, valid,
+			  COALESCE(platform_normalized, ''), COALESCE(fingerprint_hash, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSolution(row rowScanner) (*Solution, error) {
 	solution := &Solution{}
-	err := db.conn.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&solution.ID, &solution.ChallengeID, &solution.Nonce, &solution.Hash,
 		&solution.Fingerprint, &solution.ClientIP, &solution.UserAgent,
-		&solution.CreatedAt, &solution.Valid,
+		&solution.CreatedAt, &solution.Valid, &solution.PlatformNormalized,
+		&solution.FingerprintHash,
 	)
+	return solution, err
+}
+
+func (db *DB) GetSolution(id string) (*Solution, error) {
+	query := `SELECT ` + solutionColumns + ` FROM solutions WHERE id = $1`
 	
+	solution, err := scanSolution(db.conn.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -148,15 +573,588 @@ func (db *DB) GetSolution(id string) (*Solution, error) {
 	return solution, err
 }
 
-func (db *DB) CleanupExpiredChallenges() error {
-	query := `DELETE FROM challenges WHERE expires_at < NOW() AND solved = false`
-	_, err := db.conn.Exec(query)
-	return err
+func (db *DB) GetSolutionsByFingerprintHash(hash string, limit int) ([]*Solution, error) {
+	query := `SELECT ` + solutionColumns + ` FROM solutions
+			  WHERE fingerprint_hash = $1 ORDER BY created_at DESC LIMIT $2`
+
+	rows, err := db.conn.Query(query, hash, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var solutions []*Solution
+	for rows.Next() {
+		solution, err := scanSolution(rows)
+		if err != nil {
+			return nil, err
+		}
+		solutions = append(solutions, solution)
+	}
+
+	return solutions, rows.Err()
+}
+
+const (
+	platformBackfillMigration = "backfill_platform_normalized"
+	platformBackfillBatchSize = 1000
+)
+
+// BackfillPlatformNormalized fills platform_normalized for solutions stored
+// before the column existed, batch by batch, and records itself in
+// schema_migrations so later startups skip it. Rows whose fingerprint does
+// not parse are set to "other" and their IDs returned for logging.
+func (db *DB) BackfillPlatformNormalized(normalize func(string) string) (int, []string, error) {
+	var applied bool
+	if err := db.conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = $1)`,
+		platformBackfillMigration).Scan(&applied); err != nil {
+		return 0, nil, err
+	}
+	if applied {
+		return 0, nil, nil
+	}
+
+	var total int
+	var unparseable []string
+	for {
+		updated, failed, err := db.backfillPlatformBatch(normalize)
+		if err != nil {
+			return total, unparseable, err
+		}
+		total += updated
+		unparseable = append(unparseable, failed...)
+		if updated < platformBackfillBatchSize {
+			break
+		}
+	}
+
+	_, err := db.conn.Exec(`INSERT INTO schema_migrations (name) VALUES ($1) ON CONFLICT DO NOTHING`, platformBackfillMigration)
+	return total, unparseable, err
 }
 
-func (db *DB) CleanupOldSolutions(olderThan time.Duration) error {
+func (db *DB) backfillPlatformBatch(normalize func(string) string) (int, []string, error) {
+	rows, err := db.conn.Query(`SELECT id, fingerprint FROM solutions WHERE platform_normalized IS NULL LIMIT $1`,
+		platformBackfillBatchSize)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var values []string
+	var args []interface{}
+	var unparseable []string
+	for rows.Next() {
+		var id, fingerprintJSON string
+		if err := rows.Scan(&id, &fingerprintJSON); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+
+		platform := "other"
+		var fingerprint FingerprintData
+		if err := json.Unmarshal([]byte(fingerprintJSON), &fingerprint); err != nil {
+			unparseable = append(unparseable, id)
+		} else {
+			platform = normalize(fingerprint.Platform)
+		}
+
+		values = append(values, fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, id, platform)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(values) == 0 {
+		return 0, nil, nil
+	}
+
+	query := `UPDATE solutions SET platform_normalized = v.platform
+			  FROM (VALUES ` + strings.Join(values, ", ") + `) AS v(id, platform)
+			  WHERE solutions.id = v.id`
+	if _, err := db.conn.Exec(query, args...); err != nil {
+		return 0, nil, err
+	}
+
+	return len(values), unparseable, nil
+}
+
+type RetentionCleanupResult struct {
+	ChallengesSolved  int64
+	ChallengesExpired int64
+	SolutionsValid    int64
+	SolutionsInvalid  int64
+}
+
+// ApplyRetentionPolicy deletes each category past its own retention.
+// Solutions go first; a challenge is only deleted once no solution still
+// references it, so solutions can outlive the challenge retention.
+func (db *DB) ApplyRetentionPolicy(policy config.RetentionPolicy) (*RetentionCleanupResult, error) {
+	now := time.Now()
+	cutoff := func(days int) time.Time {
+		return now.AddDate(0, 0, -days)
+	}
+
+	result := &RetentionCleanupResult{}
+	steps := []struct {
+		query  string
+		cutoff time.Time
+		count  *int64
+	}{
+		{`DELETE FROM solutions WHERE valid = true AND created_at < $1`,
+			cutoff(policy.SolutionValidRetentionDays), &result.SolutionsValid},
+		{`DELETE FROM solutions WHERE valid = false AND created_at < $1`,
+			cutoff(policy.SolutionInvalidRetentionDays), &result.SolutionsInvalid},
+		{`DELETE FROM challenges c WHERE solved = true AND COALESCE(solved_at, created_at) < $1
+			AND NOT EXISTS (SELECT 1 FROM solutions s WHERE s.challenge_id = c.id)`,
+			cutoff(policy.ChallengeSolvedRetentionDays), &result.ChallengesSolved},
+		{`DELETE FROM challenges c WHERE solved = false AND expires_at < $1
+			AND NOT EXISTS (SELECT 1 FROM solutions s WHERE s.challenge_id = c.id)`,
+			cutoff(policy.ChallengeExpiredRetentionDays), &result.ChallengesExpired},
+	}
+
+	for _, step := range steps {
+		res, err := db.conn.Exec(step.query, step.cutoff)
+		if err != nil {
+			return nil, err
+		}
+		if *step.count, err = res.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (db *DB) CleanupOldSolutions(olderThan time.Duration) (int64, error) {
 	query := `DELETE FROM solutions WHERE created_at < $1`
 	cutoff := time.Now().Add(-olderThan)
-	_, err := db.conn.Exec(query, cutoff)
+	result, err := db.conn.Exec(query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+} 
+
+func (db *DB) BlockIP(ip, reason string, ttl time.Duration) error {
+	query := `INSERT INTO ip_blocklist (ip, reason, expires_at) VALUES ($1, $2, $3)
+			  ON CONFLICT (ip) DO UPDATE SET reason = EXCLUDED.reason, created_at = NOW(), expires_at = EXCLUDED.expires_at`
+	_, err := db.conn.Exec(query, ip, reason, time.Now().Add(ttl))
+	return err
+}
+
+func (db *DB) IsIPBlocked(ip string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM ip_blocklist WHERE ip = $1 AND expires_at > NOW())`
+
+	var blocked bool
+	err := db.conn.QueryRow(query, ip).Scan(&blocked)
+	return blocked, err
+}
+
+func (db *DB) WriteConfigAudit(entry *ConfigAuditEntry) error {
+	query := `INSERT INTO config_audit (event_type, old_key_hash, new_key_hash, source)
+			  VALUES ($1, $2, $3, $4)`
+	_, err := db.conn.Exec(query, entry.EventType, entry.OldKeyHash, entry.NewKeyHash, entry.Source)
+	return err
+}
+
+func (db *DB) LatestConfigAuditKeyHash(eventPrefix string) (string, error) {
+	query := `SELECT new_key_hash FROM config_audit
+			  WHERE event_type LIKE $1 || '%' AND new_key_hash <> ''
+			  ORDER BY performed_at DESC, id DESC LIMIT 1`
+
+	var hash string
+	err := db.conn.QueryRow(query, eventPrefix).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+func (db *DB) GetConfigAudit(page, limit int) ([]*ConfigAuditEntry, error) {
+	query := `SELECT id, event_type, old_key_hash, new_key_hash, performed_at, source
+			  FROM config_audit
+			  ORDER BY performed_at DESC, id DESC
+			  LIMIT $1 OFFSET $2`
+
+	rows, err := db.conn.Query(query, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*ConfigAuditEntry
+	for rows.Next() {
+		entry := &ConfigAuditEntry{}
+		if err := rows.Scan(&entry.ID, &entry.EventType, &entry.OldKeyHash, &entry.NewKeyHash,
+			&entry.PerformedAt, &entry.Source); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (db *DB) RateLimitAcquire(key string, maxCount int, windowSecs int) (bool, error) {
+	return db.RateLimitAcquireN(key, 1, maxCount, windowSecs)
+}
+
+// RateLimitAcquireN records n hits for key if that keeps the key within
+// maxCount hits over the last windowSecs seconds. The advisory lock
+// serializes callers per key across every server sharing the database.
+func (db *DB) RateLimitAcquireN(key string, n, maxCount, windowSecs int) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM rate_limit_entries WHERE key = $1 AND ts < NOW() - make_interval(secs => $2)`,
+		key, windowSecs); err != nil {
+		return false, err
+	}
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM rate_limit_entries WHERE key = $1`, key).Scan(&count); err != nil {
+		return false, err
+	}
+
+	if count+n > maxCount {
+		return false, tx.Commit()
+	}
+
+	if _, err := tx.Exec(`INSERT INTO rate_limit_entries (key, ts) SELECT $1, NOW() FROM generate_series(1, $2)`,
+		key, n); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (db *DB) CleanupRateLimitEntries(olderThan time.Duration) (int64, error) {
+	query := `DELETE FROM rate_limit_entries WHERE ts < $1`
+	result, err := db.conn.Exec(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (db *DB) WriteAuditEntry(entry *AuditEntry) error {
+	query := `INSERT INTO audit_log (event_type, client_ip, user_agent, metadata)
+			  VALUES ($1, $2, $3, $4)`
+	_, err := db.conn.Exec(query, entry.EventType, entry.ClientIP, entry.UserAgent, entry.Metadata)
 	return err
-} 
\ No newline at end of file
+}
+
+func (db *DB) SearchAuditLog(query string, page, limit int) ([]*AuditEntry, error) {
+	sqlQuery := `SELECT id, event_type, client_ip, user_agent, metadata, created_at
+			  FROM audit_log
+			  WHERE to_tsvector('english', client_ip || ' ' || user_agent || ' ' || metadata) @@ plainto_tsquery('english', $1)
+			     OR client_ip LIKE $1 || '%'
+			  ORDER BY created_at DESC
+			  LIMIT $2 OFFSET $3`
+
+	rows, err := db.conn.Query(sqlQuery, query, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		entry := &AuditEntry{}
+		if err := rows.Scan(&entry.ID, &entry.EventType, &entry.ClientIP, &entry.UserAgent,
+			&entry.Metadata, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// RecordFingerprintFieldFailures adds counts to today's totals in one
+// statement.
+func (db *DB) RecordFingerprintFieldFailures(counts map[FingerprintFailure]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(counts))
+	args := make([]interface{}, 0, 3*len(counts))
+	for failure, count := range counts {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, CURRENT_DATE)", n+1, n+2, n+3))
+		args = append(args, failure.Field, failure.Reason, count)
+	}
+
+	query := `INSERT INTO fingerprint_failures (field, reason, count, day)
+			  VALUES ` + strings.Join(values, ", ") + `
+			  ON CONFLICT (field, reason, day) DO UPDATE SET count = fingerprint_failures.count + EXCLUDED.count`
+	_, err := db.conn.Exec(query, args...)
+	return err
+}
+
+func (db *DB) GetFingerprintFailureStats(days int) ([]*FingerprintFailureStat, error) {
+	query := `SELECT field, reason, SUM(count) AS total
+			  FROM fingerprint_failures
+			  WHERE day > CURRENT_DATE - $1::integer
+			  GROUP BY field, reason
+			  ORDER BY total DESC`
+
+	rows, err := db.conn.Query(query, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*FingerprintFailureStat
+	var total int64
+	for rows.Next() {
+		stat := &FingerprintFailureStat{}
+		if err := rows.Scan(&stat.Field, &stat.Reason, &stat.Count); err != nil {
+			return nil, err
+		}
+		total += stat.Count
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, stat := range stats {
+		stat.Share = float64(stat.Count) / float64(total)
+	}
+
+	return stats, nil
+}
+
+// RecordDifficultySnapshot stores the given parameters together with the solve
+// rate and median solve time of standard challenges issued within window.
+func (db *DB) RecordDifficultySnapshot(prefixLength int, memory, timeParam uint32, window time.Duration) (*DifficultySnapshot, error) {
+	query := `INSERT INTO difficulty_history (prefix_length, memory, time_param, solve_rate_pct, median_solve_ms)
+			  SELECT $1, $2, $3,
+			         COALESCE(100.0 * COUNT(*) FILTER (WHERE solved) / NULLIF(COUNT(*), 0), 0),
+			         COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (
+			             ORDER BY EXTRACT(EPOCH FROM solved_at - created_at) * 1000
+			         ) FILTER (WHERE solved AND solved_at IS NOT NULL), 0)::BIGINT
+			  FROM challenges
+			  WHERE challenge_type = $4 AND created_at > NOW() - $5::integer * INTERVAL '1 second'
+			  RETURNING timestamp, prefix_length, memory, time_param, solve_rate_pct, median_solve_ms`
+
+	snapshot := &DifficultySnapshot{}
+	err := db.conn.QueryRow(query, prefixLength, memory, timeParam, ChallengeTypeStandard, int(window.Seconds())).Scan(
+		&snapshot.Timestamp, &snapshot.PrefixLength, &snapshot.Memory, &snapshot.TimeParam,
+		&snapshot.SolveRatePct, &snapshot.MedianSolveMs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (db *DB) GetDifficultyHistory(start, end time.Time) ([]*DifficultySnapshot, error) {
+	query := `SELECT timestamp, prefix_length, memory, time_param, solve_rate_pct, median_solve_ms
+			  FROM difficulty_history
+			  WHERE timestamp >= $1 AND timestamp <= $2
+			  ORDER BY timestamp`
+
+	rows, err := db.conn.Query(query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []*DifficultySnapshot
+	for rows.Next() {
+		snapshot := &DifficultySnapshot{}
+		if err := rows.Scan(&snapshot.Timestamp, &snapshot.PrefixLength, &snapshot.Memory, &snapshot.TimeParam,
+			&snapshot.SolveRatePct, &snapshot.MedianSolveMs); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// statsTopUserAgents is how many of the most frequent solver user agents
+// GetStats reports.
+const statsTopUserAgents = 5
+
+// GetStats aggregates in one query. bucketUnit is a DATE_TRUNC unit such as
+// "hour"; empty skips the per-bucket breakdown. The last-hour counts ignore
+// window but honour the filter.
+func (db *DB) GetStats(window time.Duration, bucketUnit string, filter StatsFilter) (*Stats, error) {
+	var metaFilter interface{}
+	if filter.MetaKey != "" {
+		metaJSON, err := json.Marshal(map[string]string{filter.MetaKey: filter.MetaValue})
+		if err != nil {
+			return nil, err
+		}
+		metaFilter = string(metaJSON)
+	}
+
+	var unit interface{}
+	if bucketUnit != "" {
+		unit = bucketUnit
+	}
+
+	query := `WITH recent AS (
+				  SELECT id, solved, created_at, solved_at
+				  FROM challenges
+				  WHERE challenge_type = $1
+				    AND created_at > NOW() - GREATEST($2::integer, 3600) * INTERVAL '1 second'
+				    AND ($3::jsonb IS NULL OR metadata @> $3::jsonb)
+			  ), c AS (
+				  SELECT * FROM recent WHERE created_at > NOW() - $2::integer * INTERVAL '1 second'
+			  ), s AS (
+				  SELECT solutions.valid, solutions.client_ip, solutions.user_agent,
+				         COALESCE(solutions.platform_normalized, 'other') AS platform
+				  FROM solutions JOIN c ON c.id = solutions.challenge_id
+			  )
+			  SELECT
+				  (SELECT COUNT(*) FROM c),
+				  (SELECT COUNT(*) FILTER (WHERE solved) FROM c),
+				  (SELECT COUNT(*) FROM s),
+				  (SELECT COUNT(*) FILTER (WHERE valid) FROM s),
+				  (SELECT COALESCE(AVG(EXTRACT(EPOCH FROM solved_at - created_at) * 1000), 0)
+				   FROM c WHERE solved AND solved_at IS NOT NULL),
+				  (SELECT COUNT(DISTINCT client_ip) FROM s),
+				  (SELECT COUNT(*) FROM recent WHERE created_at > NOW() - INTERVAL '1 hour'),
+				  (SELECT COUNT(*) FILTER (WHERE solved) FROM recent WHERE created_at > NOW() - INTERVAL '1 hour'),
+				  (SELECT COALESCE(json_agg(user_agent ORDER BY hits DESC, user_agent), '[]')
+				   FROM (SELECT user_agent, COUNT(*) AS hits FROM s GROUP BY user_agent
+				         ORDER BY hits DESC, user_agent LIMIT $4) ua),
+				  (SELECT COALESCE(json_object_agg(platform, hits), '{}')
+				   FROM (SELECT platform, COUNT(*) AS hits FROM s GROUP BY platform) p),
+				  (SELECT COALESCE(json_agg(b ORDER BY b.start), '[]')
+				   FROM (SELECT DATE_TRUNC($5::text, created_at) AS start,
+				                COUNT(*) AS "challengesGenerated",
+				                COUNT(*) FILTER (WHERE solved) AS "challengesSolved",
+				                COALESCE(AVG(EXTRACT(EPOCH FROM solved_at - created_at) * 1000)
+				                         FILTER (WHERE solved AND solved_at IS NOT NULL), 0) AS "averageSolveMs"
+				         FROM c WHERE $5::text IS NOT NULL GROUP BY 1) b)`
+
+	stats := &Stats{}
+	var topUserAgents, platforms, buckets []byte
+	err := db.conn.QueryRow(query, ChallengeTypeStandard, int(window.Seconds()), metaFilter, statsTopUserAgents, unit).Scan(
+		&stats.ChallengesGenerated, &stats.ChallengesSolved, &stats.SolutionsSubmitted,
+		&stats.ValidSolutions, &stats.AverageSolveMs, &stats.UniqueIPs,
+		&stats.ChallengesGeneratedLast1h, &stats.ChallengesSolvedLast1h, &topUserAgents, &platforms, &buckets,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(topUserAgents, &stats.TopUserAgents); err != nil {
+		return nil, fmt.Errorf("failed to decode top user agents: %w", err)
+	}
+	if err := json.Unmarshal(platforms, &stats.Platforms); err != nil {
+		return nil, fmt.Errorf("failed to decode platform counts: %w", err)
+	}
+	if err := json.Unmarshal(buckets, &stats.Buckets); err != nil {
+		return nil, fmt.Errorf("failed to decode stats buckets: %w", err)
+	}
+
+	if stats.SolutionsSubmitted > 0 {
+		stats.SolutionValidRate = float64(stats.ValidSolutions) / float64(stats.SolutionsSubmitted)
+	}
+
+	return stats, nil
+}
+
+// ErrUnknownCursor is returned by GetIPHistory when the cursor names no
+// solution from the IP, for example because cleanup deleted it.
+var ErrUnknownCursor = errors.New("unknown cursor")
+
+// GetIPHistory pages through the solutions submitted from ip, newest first.
+// cursor is the ID of the last solution on the previous page, or empty for
+// the first page. Risk scores come from the verify events in the audit log.
+func (db *DB) GetIPHistory(ip string, cursor string, limit int) (*IPHistory, error) {
+	history := &IPHistory{IP: ip}
+
+	if cursor != "" {
+		var exists bool
+		if err := db.conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM solutions WHERE id = $1 AND client_ip = $2)`,
+			cursor, ip).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrUnknownCursor
+		}
+	}
+
+	query := `SELECT
+				  (SELECT COUNT(*) FROM challenges WHERE client_ip = $1),
+				  (SELECT COUNT(*) FROM challenges WHERE client_ip = $1 AND solved),
+				  LEAST(
+					  (SELECT MIN(created_at) FROM challenges WHERE client_ip = $1),
+					  (SELECT MIN(created_at) FROM solutions WHERE client_ip = $1)
+				  ),
+				  GREATEST(
+					  (SELECT MAX(created_at) FROM challenges WHERE client_ip = $1),
+					  (SELECT MAX(created_at) FROM solutions WHERE client_ip = $1)
+				  )`
+
+	if err := db.conn.QueryRow(query, ip).Scan(&history.ChallengesCreated, &history.ChallengesSolved,
+		&history.FirstSeen, &history.LastSeen); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT ` + solutionColumns + ` FROM solutions
+			 WHERE client_ip = $1
+			   AND ($2 = '' OR (created_at, id) < (SELECT created_at, id FROM solutions WHERE id = $2))
+			 ORDER BY created_at DESC, id DESC
+			 LIMIT $3`
+
+	rows, err := db.conn.Query(query, ip, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		solution, err := scanSolution(rows)
+		if err != nil {
+			return nil, err
+		}
+		history.Solutions = append(history.Solutions, solution)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(history.Solutions) > limit {
+		history.Solutions = history.Solutions[:limit]
+		history.NextCursor = history.Solutions[limit-1].ID
+	}
+
+	query = `SELECT (metadata::jsonb->>'riskScore')::double precision, created_at
+			 FROM audit_log
+			 WHERE client_ip = $1 AND event_type = 'verify' AND metadata::jsonb ? 'riskScore'
+			 ORDER BY created_at DESC
+			 LIMIT $2`
+
+	scoreRows, err := db.conn.Query(query, ip, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer scoreRows.Close()
+
+	for scoreRows.Next() {
+		sample := &RiskScoreSample{}
+		if err := scoreRows.Scan(&sample.Score, &sample.At); err != nil {
+			return nil, err
+		}
+		history.RiskScores = append(history.RiskScores, sample)
+	}
+
+	return history, scoreRows.Err()
+}
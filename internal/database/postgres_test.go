@@ -0,0 +1,412 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"captcha/internal/config"
+)
+
+// postgresBinaries finds initdb and pg_ctl in POSTGRES_BIN_DIR, on PATH, or
+// under /usr/lib/postgresql/*/bin where Debian installs them. Tests needing
+// a server are skipped when they are missing.
+func postgresBinaries(t *testing.T) (string, string) {
+	t.Helper()
+
+	if os.Geteuid() == 0 {
+		t.Skip("initdb refuses to run as root")
+	}
+
+	dirs := []string{os.Getenv("POSTGRES_BIN_DIR")}
+	matches, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	dirs = append(dirs, matches...)
+
+	if initdb, err := exec.LookPath("initdb"); err == nil {
+		if pgCtl, err := exec.LookPath("pg_ctl"); err == nil {
+			return initdb, pgCtl
+		}
+	}
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		initdb := filepath.Join(dir, "initdb")
+		pgCtl := filepath.Join(dir, "pg_ctl")
+		if _, err := os.Stat(initdb); err != nil {
+			continue
+		}
+		if _, err := os.Stat(pgCtl); err != nil {
+			continue
+		}
+		return initdb, pgCtl
+	}
+
+	t.Skip("PostgreSQL binaries not found; set POSTGRES_BIN_DIR to run database tests")
+	return "", ""
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// serverTLS names the PEM files a throwaway server is started with.
+type serverTLS struct {
+	caCert     string
+	serverCert string
+	serverKey  string
+}
+
+// startPostgres initializes and starts a throwaway cluster in a temporary
+// directory and returns a configuration that connects to it. With tlsFiles
+// set, the server only accepts TLS connections presenting a client
+// certificate signed by the same CA.
+func startPostgres(t *testing.T, tlsFiles *serverTLS) *config.Config {
+	t.Helper()
+
+	initdb, pgCtl := postgresBinaries(t)
+	dataDir := filepath.Join(t.TempDir(), "data")
+	port := freePort(t)
+
+	out, err := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "-A", "trust").CombinedOutput()
+	if err != nil {
+		t.Fatalf("initdb failed: %v\n%s", err, out)
+	}
+
+	settings := fmt.Sprintf("listen_addresses = '127.0.0.1'\nport = %d\nunix_socket_directories = '%s'\n", port, dataDir)
+	hba := "local all all trust\nhost all all 127.0.0.1/32 trust\n"
+	if tlsFiles != nil {
+		settings += fmt.Sprintf("ssl = on\nssl_cert_file = '%s'\nssl_key_file = '%s'\nssl_ca_file = '%s'\n",
+			tlsFiles.serverCert, tlsFiles.serverKey, tlsFiles.caCert)
+		hba = "local all all trust\nhostssl all all 127.0.0.1/32 trust clientcert=verify-full\n"
+	}
+
+	if err := appendFile(filepath.Join(dataDir, "postgresql.conf"), settings); err != nil {
+		t.Fatalf("failed to write postgresql.conf: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "pg_hba.conf"), []byte(hba), 0600); err != nil {
+		t.Fatalf("failed to write pg_hba.conf: %v", err)
+	}
+
+	logFile := filepath.Join(dataDir, "server.log")
+	if out, err := exec.Command(pgCtl, "-D", dataDir, "-l", logFile, "-w", "start").CombinedOutput(); err != nil {
+		serverLog, _ := os.ReadFile(logFile)
+		t.Fatalf("pg_ctl start failed: %v\n%s\n%s", err, out, serverLog)
+	}
+	t.Cleanup(func() {
+		exec.Command(pgCtl, "-D", dataDir, "-m", "immediate", "-w", "stop").Run()
+	})
+
+	return &config.Config{
+		DBHost:               "localhost",
+		DBPort:               port,
+		DBUser:               "postgres",
+		DBName:               "postgres",
+		DBSSLMode:            "disable",
+		ChallengeMaxAttempts: 10,
+	}
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// testCA signs certificates for a throwaway server and its clients.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "captcha test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+
+	path := filepath.Join(dir, "ca.crt")
+	writePEM(t, path, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, path: path}
+}
+
+// issue writes a certificate for commonName and its key to dir and returns
+// their paths. Server certificates are valid for localhost and 127.0.0.1.
+func (ca *testCA) issue(t *testing.T, dir, name, commonName string, server bool) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	writePEM(t, certPath, "CERTIFICATE", der)
+	writePEM(t, keyPath, "PRIVATE KEY", keyDER)
+	return certPath, keyPath
+}
+
+// writePEM uses 0600 throughout: both PostgreSQL and lib/pq refuse private
+// keys readable by others.
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestDBTLSConnection(t *testing.T) {
+	certDir := t.TempDir()
+	ca := newTestCA(t, certDir)
+	serverCert, serverKey := ca.issue(t, certDir, "server", "localhost", true)
+	clientCert, clientKey := ca.issue(t, certDir, "client", "postgres", false)
+
+	cfg := startPostgres(t, &serverTLS{caCert: ca.path, serverCert: serverCert, serverKey: serverKey})
+	cfg.DBSSLMode = "verify-full"
+	cfg.DBSSLRootCert = ca.path
+	cfg.DBSSLCert = clientCert
+	cfg.DBSSLKey = clientKey
+
+	db, err := NewDB(cfg)
+	if err != nil {
+		t.Fatalf("NewDB with verify-full failed: %v", err)
+	}
+	defer db.Close()
+
+	var ssl bool
+	if err := db.conn.QueryRow(`SELECT ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()`).Scan(&ssl); err != nil {
+		t.Fatalf("failed to query connection TLS state: %v", err)
+	}
+	if !ssl {
+		t.Fatal("connection is not using TLS")
+	}
+
+	t.Run("untrusted root certificate", func(t *testing.T) {
+		otherCA := newTestCA(t, t.TempDir())
+
+		untrusted := *cfg
+		untrusted.DBSSLRootCert = otherCA.path
+		if db, err := NewDB(&untrusted); err == nil {
+			db.Close()
+			t.Fatal("NewDB succeeded with a root certificate that did not sign the server's")
+		}
+	})
+
+	t.Run("missing certificate file", func(t *testing.T) {
+		missing := *cfg
+		missing.DBSSLKey = filepath.Join(certDir, "missing-"+strconv.Itoa(cfg.DBPort)+".key")
+		if _, err := NewDB(&missing); err == nil {
+			t.Fatal("NewDB succeeded with an unreadable sslkey")
+		}
+	})
+}
+
+func TestConnectionPoolCap(t *testing.T) {
+	cfg := startPostgres(t, nil)
+	cfg.DBMaxOpenConns = 10
+	cfg.DBMaxIdleConns = 5
+	cfg.DBConnMaxLifetimeSecs = 300
+
+	db, err := NewDB(cfg)
+	if err != nil {
+		t.Fatalf("NewDB failed: %v", err)
+	}
+	defer db.Close()
+
+	const clients = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.conn.Exec(`SELECT pg_sleep(0.1)`); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	peak := 0
+	for sampling := true; sampling; {
+		select {
+		case <-done:
+			sampling = false
+		case <-time.After(5 * time.Millisecond):
+			if open := db.Stats().OpenConnections; open > peak {
+				peak = open
+			}
+		}
+	}
+
+	close(errs)
+	for err := range errs {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	if peak > cfg.DBMaxOpenConns {
+		t.Fatalf("peak open connections = %d, want at most DB_MAX_OPEN_CONNS = %d", peak, cfg.DBMaxOpenConns)
+	}
+	if waits := db.Stats().WaitCount; waits == 0 {
+		t.Fatalf("WaitCount = 0; %d concurrent queries should have queued for %d connections", clients, cfg.DBMaxOpenConns)
+	}
+	if idle := db.Stats().Idle; idle > cfg.DBMaxIdleConns {
+		t.Fatalf("idle connections = %d, want at most DB_MAX_IDLE_CONNS = %d", idle, cfg.DBMaxIdleConns)
+	}
+}
+
+func TestFingerprintHash(t *testing.T) {
+	first := `{"userAgent":"Mozilla/5.0","platform":"Win32","screenResolution":"1920x1080","canvasHash":"abc","pageAgeSeconds":3,"wasmInstantiationTimeMs":40}`
+	repeat := `{"userAgent":"Mozilla/5.0","platform":"Win32","screenResolution":"1920x1080","canvasHash":"abc","pageAgeSeconds":95,"wasmInstantiationTimeMs":12}`
+	other := `{"userAgent":"Mozilla/5.0","platform":"Win32","screenResolution":"2560x1440","canvasHash":"abc","pageAgeSeconds":3,"wasmInstantiationTimeMs":40}`
+
+	if FingerprintHash(first) != FingerprintHash(repeat) {
+		t.Error("solves from one device hash differently")
+	}
+	if FingerprintHash(first) == FingerprintHash(other) {
+		t.Error("devices with different screens share a hash")
+	}
+	if FingerprintHash("not json") == "" {
+		t.Error("unparseable fingerprint has no hash")
+	}
+}
+
+func TestCreateValidSolutionCap(t *testing.T) {
+	cfg := startPostgres(t, nil)
+	cfg.DBMaxOpenConns = 20
+
+	db, err := NewDB(cfg)
+	if err != nil {
+		t.Fatalf("NewDB failed: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	challenge := &Challenge{
+		ID: "cap", Salt: "c2FsdA==", Difficulty: 1, Memory: 1024, Threads: 1, KeyLen: 32, Target: "00",
+		CreatedAt: now, ExpiresAt: now.Add(time.Minute), Type: ChallengeTypeStandard, Algorithm: "argon2id", Variant: "id",
+	}
+	if err := db.CreateChallenge(challenge); err != nil {
+		t.Fatalf("CreateChallenge failed: %v", err)
+	}
+
+	const maxValid, clients = 3, 20
+	var accepted, capped atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.CreateValidSolution(&Solution{
+				ID: fmt.Sprintf("solution-%d", i), ChallengeID: challenge.ID, Nonce: strconv.Itoa(i),
+				Hash: "00", Fingerprint: "{}", ClientIP: "127.0.0.1", CreatedAt: now, Valid: true,
+			}, maxValid)
+			switch {
+			case err == nil:
+				accepted.Add(1)
+			case errors.Is(err, ErrValidSolutionCap):
+				capped.Add(1)
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := accepted.Load(); got != maxValid {
+		t.Fatalf("accepted %d valid solutions, want %d", got, maxValid)
+	}
+	if got := capped.Load(); got != clients-maxValid {
+		t.Fatalf("%d submissions hit the cap, want %d", got, clients-maxValid)
+	}
+
+	count, err := db.CountValidSolutions(challenge.ID)
+	if err != nil {
+		t.Fatalf("CountValidSolutions failed: %v", err)
+	}
+	if count != maxValid {
+		t.Fatalf("CountValidSolutions = %d, want %d", count, maxValid)
+	}
+}
@@ -0,0 +1,80 @@
+package fingerprint
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"captcha/internal/database"
+)
+
+const failureFlushInterval = 10 * time.Second
+
+// failureRecorder counts field failures in memory and writes them to the
+// database in the background, so a rejected fingerprint costs the verify
+// path no database writes.
+type failureRecorder struct {
+	db *database.DB
+
+	mu     sync.Mutex
+	counts map[database.FingerprintFailure]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newFailureRecorder(db *database.DB) *failureRecorder {
+	return &failureRecorder{
+		db:     db,
+		counts: make(map[database.FingerprintFailure]int64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (r *failureRecorder) record(field, reason string) {
+	r.mu.Lock()
+	r.counts[database.FingerprintFailure{Field: field, Reason: reason}]++
+	r.mu.Unlock()
+}
+
+func (r *failureRecorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(failureFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.stop:
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush keeps the counts for the next attempt when the write fails.
+func (r *failureRecorder) flush() {
+	r.mu.Lock()
+	counts := r.counts
+	r.counts = make(map[database.FingerprintFailure]int64)
+	r.mu.Unlock()
+
+	if err := r.db.RecordFingerprintFieldFailures(counts); err != nil {
+		log.Printf("Failed to record %d fingerprint failure counts: %v", len(counts), err)
+
+		r.mu.Lock()
+		for failure, count := range counts {
+			r.counts[failure] += count
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Stop writes any remaining counts and waits for the flush to finish.
+func (r *failureRecorder) Stop() {
+	close(r.stop)
+	<-r.done
+}
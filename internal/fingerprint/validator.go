@@ -1,15 +1,20 @@
 package fingerprint
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"captcha/internal/config"
 	"captcha/internal/crypto"
 	"captcha/internal/database"
+	"captcha/internal/metrics"
 )
 
 func min(a, b int) int {
@@ -19,21 +24,111 @@ func min(a, b int) int {
 	return b
 }
 
+// Chrome coarsens performance.now() to 100µs and Safari to 1ms outside
+// cross-origin isolation, so those defaults weigh little or nothing.
+var suspiciousTimerGranularities = map[float64]float64{
+	5:    0.2,
+	20:   0.2,
+	1000: 0.05,
+}
+
+const mediaQueryCount = 20
+
+const suspiciousPageAgeSeconds = 12 * 60 * 60
+
+// Chrome has shipped CSS grid since 57, so a UA claiming 90+ without it is
+// either lying or running a stripped-down engine.
+const chromeGridMinVersion = 90
+
+var chromeVersionPattern = regexp.MustCompile(`Chrome/(\d+)\.`)
+
+const (
+	minScreenAspectRatio = 0.4
+	maxScreenAspectRatio = 4.0
+
+	// Most GPUs cap textures at 16384 pixels, so no real display renders a
+	// wider framebuffer than this.
+	maxPhysicalScreenWidth = 16384
+)
+
+// Device pixel ratios shipped by mainstream displays, including those
+// displays at the zoom levels Chrome and Firefox offer (67%, 90%, 110%,
+// 133%, ...). Anything else usually means an emulated viewport.
+var commonPixelRatios = []float64{
+	0.25, 0.33, 0.5, 0.67, 0.75, 0.8, 0.9, 1, 1.1, 1.2, 1.25, 1.33, 1.5, 1.7, 1.75,
+	1.8, 2, 2.2, 2.4, 2.5, 2.625, 2.66, 2.75, 3, 3.4, 3.5, 4, 5,
+}
+
+// Headless browsers and automation frameworks rarely change the language
+// from this, while real users who bother enabling Do Not Track often do.
+const defaultLanguage = "en-US"
+
 type Validator struct {
-	cfg *config.Config
-	key []byte
+	cfg      *atomic.Pointer[config.Config]
+	db       *database.DB
+	keys     *crypto.KeyStore
+	failures *failureRecorder
+}
+
+// NewValidator starts a background writer for failure telemetry when db is
+// set; call Shutdown to flush it.
+func NewValidator(cfg *atomic.Pointer[config.Config], db *database.DB, keys *crypto.KeyStore) *Validator {
+	v := &Validator{
+		cfg:  cfg,
+		db:   db,
+		keys: keys,
+	}
+	if db != nil {
+		v.failures = newFailureRecorder(db)
+		go v.failures.run()
+	}
+	return v
 }
 
-func NewValidator(cfg *config.Config, key []byte) *Validator {
-	return &Validator{
-		cfg: cfg,
-		key: key,
+// Shutdown writes failure counts that have not been flushed yet.
+func (v *Validator) Shutdown() {
+	if v.failures != nil {
+		v.failures.Stop()
 	}
 }
 
 func (v *Validator) ValidateFingerprint(encryptedFingerprint string) (*database.FingerprintData, error) {
+	fingerprint, err := v.decodeFingerprint(encryptedFingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.validateFingerprintFields(fingerprint); err != nil {
+		return nil, fmt.Errorf("fingerprint validation failed: %w", err)
+	}
+
+	return fingerprint, nil
+}
+
+// ValidateFieldsReport runs every field validator and returns "valid" or
+// "invalid: <reason>" per field. Failures are not recorded in telemetry.
+func (v *Validator) ValidateFieldsReport(encryptedFingerprint string) (map[string]string, bool, error) {
+	fingerprint, err := v.decodeFingerprint(encryptedFingerprint)
+	if err != nil {
+		return nil, false, err
+	}
+
+	report := make(map[string]string)
+	valid := true
+	for _, check := range v.fieldChecks(fingerprint) {
+		if check.err != nil {
+			report[check.field] = "invalid: " + check.err.Error()
+			valid = false
+		} else {
+			report[check.field] = "valid"
+		}
+	}
+
+	return report, valid, nil
+}
 
-	decryptedData, err := crypto.Decrypt(encryptedFingerprint, v.key)
+func (v *Validator) decodeFingerprint(encryptedFingerprint string) (*database.FingerprintData, error) {
+	decryptedData, err := crypto.Decrypt(encryptedFingerprint, v.keys)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt fingerprint: %w", err)
 	}
@@ -50,61 +145,237 @@ func (v *Validator) ValidateFingerprint(encryptedFingerprint string) (*database.
 		return nil, fmt.Errorf("failed to parse fingerprint JSON: %w", err)
 	}
 
-	if err := v.validateFingerprintFields(&fingerprint); err != nil {
-		return nil, fmt.Errorf("fingerprint validation failed: %w", err)
-	}
-
 	return &fingerprint, nil
 }
 
-func (v *Validator) validateFingerprintFields(fp *database.FingerprintData) error {
-	if err := v.validateUserAgent(fp.UserAgent); err != nil {
-		return fmt.Errorf("invalid user agent: %w", err)
+// Score estimates how likely the fingerprint came from a bot, from 0.0 to
+// 1.0, by summing weighted signals that are individually plausible but
+// unusual for real browsers. The weights keep a zoomed touchscreen laptop
+// with a second tab open below the default 0.7 threshold.
+func (v *Validator) Score(fp *database.FingerprintData) float64 {
+	score := 0.0
+
+	if platformMismatch(fp.Platform, fp.UserAgent) {
+		score += 0.3
+	}
+
+	if fp.MaxTouchPoints > 0 && desktopUserAgent(fp.UserAgent) {
+		score += 0.2
+	}
+
+	if !commonPixelRatio(fp.PixelRatio) {
+		score += 0.1
+	}
+
+	if fp.DoNotTrack == "1" && fp.Language == defaultLanguage {
+		score += 0.05
+	}
+
+	// Desktop Chrome and Firefox always list their built-in PDF viewer
+	// plugins; headless builds list none and a single language.
+	if fp.PluginCount == 0 && len(fp.Languages) == 1 && desktopUserAgent(fp.UserAgent) {
+		score += 0.2
+	}
+
+	score += suspiciousTimerGranularities[math.Round(fp.TimerGranularityUs)]
+
+	if strings.Contains(fp.Platform, "Win32") && strings.HasPrefix(fp.ScreenOrientation, "portrait") && fp.MaxTouchPoints == 0 {
+		score += 0.2
+	}
+
+	if fp.WASMInstantiationTimeMs < 50 {
+		score += 0.1
+	}
+
+	// Any other tab with the widget open answers the probe, so this only
+	// counts for much alongside other signals.
+	if fp.CrossTabCommunicationActive {
+		score += 0.15
 	}
 
-	if err := v.validateLanguage(fp.Language); err != nil {
-		return fmt.Errorf("invalid language: %w", err)
+	if fp.FingerprintResistanceDetected {
+		score += 0.05
 	}
 
-	if err := v.validatePlatform(fp.Platform); err != nil {
-		return fmt.Errorf("invalid platform: %w", err)
+	if fp.IdleCallbackLatencyMs != nil && *fp.IdleCallbackLatencyMs == 0 {
+		score += 0.1
 	}
 
-	if err := v.validateHardwareConcurrency(fp.HardwareConcurrency); err != nil {
-		return fmt.Errorf("invalid hardware concurrency: %w", err)
+	if fp.StorageQuotaGB != nil && fp.StorageUsageMB != nil && *fp.StorageUsageMB == 0 &&
+		(*fp.StorageQuotaGB == 0 || *fp.StorageQuotaGB == 5) {
+		score += 0.05
 	}
 
-	if err := v.validateMaxTouchPoints(fp.MaxTouchPoints); err != nil {
-		return fmt.Errorf("invalid max touch points: %w", err)
+	if fp.PageAgeSeconds > suspiciousPageAgeSeconds {
+		score += 0.15
+	} else if fp.PageAgeSeconds == 0 {
+		score += 0.1
 	}
 
-	if err := v.validateColorDepth(fp.ColorDepth); err != nil {
-		return fmt.Errorf("invalid color depth: %w", err)
+	if !fp.ServiceWorkerAvailable && strings.Contains(fp.UserAgent, "Chrome") {
+		score += 0.35
 	}
 
-	if err := v.validatePixelRatio(fp.PixelRatio); err != nil {
-		return fmt.Errorf("invalid pixel ratio: %w", err)
+	if strings.Contains(fp.UserAgent, "Chrome/") {
+		missingAPIs := 0
+		if !fp.PointerLockAvailable {
+			missingAPIs++
+		}
+		if !fp.FullscreenAvailable {
+			missingAPIs++
+		}
+		score += float64(missingAPIs) * 0.1
 	}
 
-	if err := v.validateTimezone(fp.Timezone); err != nil {
-		return fmt.Errorf("invalid timezone: %w", err)
+	if chromeMajorVersion(fp.UserAgent) >= chromeGridMinVersion && !fp.CSSGridSupported {
+		score += 0.3
 	}
 
-	if err := v.validateDoNotTrack(fp.DoNotTrack); err != nil {
-		return fmt.Errorf("invalid do not track: %w", err)
+	if score > 1.0 {
+		score = 1.0
 	}
 
-	if err := v.validateScreenResolution(fp.ScreenResolution); err != nil {
-		return fmt.Errorf("invalid screen resolution: %w", err)
+	return score
+}
+
+// uaPlatformHints maps the OS token of a user agent to the normalized
+// platforms a genuine browser on that OS reports. Android browsers report a
+// Linux platform, and iPadOS in desktop mode sends a Macintosh user agent
+// with a MacIntel platform, which is consistent as is. Order matters: iOS
+// user agents also contain "Mac OS X", and Android ones "Linux".
+var uaPlatformHints = []struct {
+	substring string
+	platforms []string
+}{
+	{"iPhone", []string{"ios"}},
+	{"iPad", []string{"ios"}},
+	{"iPod", []string{"ios"}},
+	{"Android", []string{"android", "linux"}},
+	{"Windows", []string{"windows"}},
+	{"Macintosh", []string{"macos"}},
+	{"CrOS", []string{"linux"}},
+	{"Linux", []string{"linux"}},
+	{"X11", []string{"linux"}},
+}
+
+// platformMismatch reports whether navigator.platform and the user agent
+// name different operating systems. Unrecognized values on either side are
+// not a mismatch.
+func platformMismatch(platform, userAgent string) bool {
+	normalized := NormalizePlatform(platform)
+	if normalized == "other" {
+		return false
 	}
 
-	if err := v.validateScreenResolution(fp.AvailableScreenResolution); err != nil {
-		return fmt.Errorf("invalid available screen resolution: %w", err)
+	for _, hint := range uaPlatformHints {
+		if !strings.Contains(userAgent, hint.substring) {
+			continue
+		}
+		for _, p := range hint.platforms {
+			if p == normalized {
+				return false
+			}
+		}
+		return true
 	}
 
+	return false
+}
+
+func (v *Validator) validateUAPlatformConsistency(fp *database.FingerprintData) error {
+	if platformMismatch(fp.Platform, fp.UserAgent) {
+		return fmt.Errorf("platform %q contradicts user agent", fp.Platform)
+	}
 	return nil
 }
 
+// desktopUserAgent excludes macOS: iPadOS requests the desktop site with a
+// Macintosh user agent and reports touch points.
+func desktopUserAgent(userAgent string) bool {
+	if strings.Contains(userAgent, "Mobile") {
+		return false
+	}
+	switch NormalizePlatform(userAgent) {
+	case "windows", "linux":
+		return true
+	}
+	return false
+}
+
+func commonPixelRatio(ratio float64) bool {
+	for _, r := range commonPixelRatios {
+		if math.Abs(ratio-r) < 0.01 {
+			return true
+		}
+	}
+	return false
+}
+
+type fieldCheck struct {
+	field string
+	err   error
+}
+
+func (v *Validator) fieldChecks(fp *database.FingerprintData) []fieldCheck {
+	return []fieldCheck{
+		{"userAgent", v.validateUserAgent(fp.UserAgent)},
+		{"language", v.validateLanguage(fp.Language)},
+		{"platform", v.validatePlatform(fp.Platform)},
+		{"platform", v.validateUAPlatformConsistency(fp)},
+		{"hardwareConcurrency", v.validateHardwareConcurrency(fp.HardwareConcurrency)},
+		{"maxTouchPoints", v.validateMaxTouchPoints(fp.MaxTouchPoints)},
+		{"colorDepth", v.validateColorDepth(fp.ColorDepth)},
+		{"pixelRatio", v.validatePixelRatio(fp.PixelRatio)},
+		{"timezone", v.validateTimezone(fp.Timezone)},
+		{"doNotTrack", v.validateDoNotTrack(fp.DoNotTrack)},
+		{"screenResolution", v.validateScreenResolution(fp.ScreenResolution)},
+		{"availableScreenResolution", v.validateScreenResolution(fp.AvailableScreenResolution)},
+		{"screenResolution", v.validateResolutionConsistency(fp)},
+		{"shadowDOMDepth", v.validateShadowDOM(fp.ShadowDOMDepth, fp.CustomElementCount)},
+		{"timerGranularityUs", v.validateTimerGranularity(fp.TimerGranularityUs)},
+		{"screenOrientation", v.validateScreenOrientation(fp.ScreenOrientation, fp.ScreenOrientationType)},
+		{"wasmInstantiationTimeMs", v.validateWASMInstantiationTime(fp.WASMInstantiationTimeMs)},
+		{"gpuMaxTextureSize", v.validateGPUMaxTextureSize(fp.GPUMaxTextureSize)},
+		{"idleCallbackLatencyMs", v.validateIdleCallbackLatency(fp.IdleCallbackLatencyMs)},
+		{"mediaQueryFingerprint", v.validateMediaQueryFingerprint(fp.MediaQueryFingerprint)},
+		{"cssAnimationTimingPrecisionUs", v.validateCSSAnimationTimingPrecision(fp.CSSAnimationTimingPrecisionUs)},
+		{"storageQuotaGB", v.validateStorageEstimate(fp.StorageQuotaGB)},
+		{"storageUsageMB", v.validateStorageEstimate(fp.StorageUsageMB)},
+		{"speechVoiceHash", v.validateSpeechVoices(fp.SpeechVoiceCount, fp.SpeechVoiceHash)},
+		{"serviceWorkerRegistered", v.validateServiceWorker(fp.ServiceWorkerAvailable, fp.ServiceWorkerRegistered)},
+		{"gpuTier", v.validateGPUTier(fp.GPUTier)},
+		{"pageAgeSeconds", v.validatePageAge(fp.PageAgeSeconds)},
+		{"supportedMIMEHash", v.validateSupportedMIMEHash(fp.SupportedMIMEHash)},
+		{"estimatedCacheLatencyMs", v.validateCacheLatency(fp.CacheAPIAvailable, fp.EstimatedCacheLatencyMs)},
+		{"cssGridSupported", v.validateCSSSupport(fp.CSSCustomPropertiesSupported, fp.CSSGridSupported, fp.CSSFlexSupported)},
+		{"clipboardContentHash", v.validateClipboardContentHash(fp.ClipboardContentHash)},
+		{"canvasHash", v.validateCanvasHash(fp.CanvasHash)},
+		{"webglRenderer", v.validateWebGL(fp.WebGLRenderer, fp.WebGLVendor, fp.WebGLExtensionCount)},
+		{"crossTabCommunicationActive", v.validateCrossTabCommunication(fp.CrossTabCommunicationActive, fp.BroadcastChannelAvailable)},
+		{"webDriver", v.validateWebDriver(fp.WebDriver)},
+		{"pluginCount", v.validatePluginCount(fp.PluginCount)},
+		{"rtcLocalIPHash", v.validateRTCLocalIPHash(fp.RTCLocalIPHash)},
+	}
+}
+
+func (v *Validator) validateFingerprintFields(fp *database.FingerprintData) error {
+	var errs []error
+	for _, check := range v.fieldChecks(fp) {
+		if check.err == nil {
+			continue
+		}
+		metrics.FingerprintValidationErrorsTotal.WithLabelValues(check.field).Inc()
+
+		if v.failures != nil {
+			v.failures.record(check.field, check.err.Error())
+		}
+
+		errs = append(errs, fmt.Errorf("invalid %s: %w", check.field, check.err))
+	}
+
+	return errors.Join(errs...)
+}
+
 func (v *Validator) validateUserAgent(userAgent string) error {
 	if len(userAgent) < 10 || len(userAgent) > 1000 {
 		return fmt.Errorf("user agent length out of range")
@@ -141,13 +412,8 @@ func (v *Validator) validateLanguage(language string) error {
 }
 
 func (v *Validator) validatePlatform(platform string) error {
-	validPlatforms := []string{
-		"Win32", "MacIntel", "Linux x86_64", "Linux i686",
-		"iPhone", "iPad", "Android", "X11",
-	}
-
-	for _, valid := range validPlatforms {
-		if strings.Contains(platform, valid) {
+	for _, valid := range v.cfg.Load().FingerprintAllowedPlatforms {
+		if valid = strings.TrimSpace(valid); valid != "" && strings.Contains(platform, valid) {
 			return nil
 		}
 	}
@@ -155,6 +421,30 @@ func (v *Validator) validatePlatform(platform string) error {
 	return fmt.Errorf("platform not recognized")
 }
 
+func NormalizePlatform(raw string) string {
+	canonical := []struct {
+		substring string
+		platform  string
+	}{
+		{"iPhone", "ios"},
+		{"iPad", "ios"},
+		{"iPod", "ios"},
+		{"Android", "android"},
+		{"Win", "windows"},
+		{"Mac", "macos"},
+		{"Linux", "linux"},
+		{"X11", "linux"},
+	}
+
+	for _, c := range canonical {
+		if strings.Contains(raw, c.substring) {
+			return c.platform
+		}
+	}
+
+	return "other"
+}
+
 func (v *Validator) validateHardwareConcurrency(concurrency int) error {
 	if concurrency < 1 || concurrency > 128 {
 		return fmt.Errorf("hardware concurrency out of range")
@@ -180,7 +470,7 @@ func (v *Validator) validateColorDepth(depth int) error {
 }
 
 func (v *Validator) validatePixelRatio(ratio float64) error {
-	if ratio < 0.5 || ratio > 5.0 {
+	if ratio < v.cfg.Load().MinPixelRatio || ratio > v.cfg.Load().MaxPixelRatio {
 		return fmt.Errorf("pixel ratio out of range")
 	}
 	return nil
@@ -223,20 +513,340 @@ func (v *Validator) validateScreenResolution(resolution string) error {
 		return fmt.Errorf("screen resolution cannot be empty")
 	}
 
+	width, height, err := parseResolution(resolution)
+	if err != nil {
+		return err
+	}
+
+	if width < v.cfg.Load().MinScreenWidth || width > v.cfg.Load().MaxScreenWidth {
+		return fmt.Errorf("screen width out of range")
+	}
+
+	if height < v.cfg.Load().MinScreenHeight || height > v.cfg.Load().MaxScreenHeight {
+		return fmt.Errorf("screen height out of range")
+	}
+
+	return nil
+} 
+
+func parseResolution(resolution string) (int, int, error) {
 	parts := strings.Split(resolution, "x")
 	if len(parts) != 2 {
-		return fmt.Errorf("screen resolution format invalid")
+		return 0, 0, fmt.Errorf("screen resolution format invalid")
 	}
 
 	width, err := strconv.Atoi(parts[0])
-	if err != nil || width < 100 || width > 10000 {
-		return fmt.Errorf("screen width out of range")
+	if err != nil {
+		return 0, 0, fmt.Errorf("screen width out of range")
 	}
 
 	height, err := strconv.Atoi(parts[1])
-	if err != nil || height < 100 || height > 10000 {
-		return fmt.Errorf("screen height out of range")
+	if err != nil {
+		return 0, 0, fmt.Errorf("screen height out of range")
+	}
+
+	return width, height, nil
+}
+
+// validateResolutionConsistency cross-checks the screen fields against each
+// other. Malformed values are left to validateScreenResolution.
+func (v *Validator) validateResolutionConsistency(fp *database.FingerprintData) error {
+	width, height, err := parseResolution(fp.ScreenResolution)
+	if err != nil || width <= 0 || height <= 0 {
+		return nil
+	}
+
+	availWidth, availHeight, err := parseResolution(fp.AvailableScreenResolution)
+	if err == nil && (availWidth > width || availHeight > height) {
+		return fmt.Errorf("available screen resolution exceeds screen resolution")
+	}
+
+	aspect := float64(width) / float64(height)
+	if aspect < minScreenAspectRatio || aspect > maxScreenAspectRatio {
+		return fmt.Errorf("screen aspect ratio implausible")
+	}
+
+	if fp.PixelRatio*float64(width) > maxPhysicalScreenWidth {
+		return fmt.Errorf("physical screen width exceeds GPU texture limits")
+	}
+
+	return nil
+}
+
+func (v *Validator) validateShadowDOM(depth, customElements int) error {
+	if depth < 0 || depth > 20 {
+		return fmt.Errorf("shadow DOM depth out of range")
+	}
+
+	if customElements < 0 || customElements > 10000 {
+		return fmt.Errorf("custom element count out of range")
+	}
+
+	return nil
+}
+
+func (v *Validator) validateTimerGranularity(granularityUs float64) error {
+	if granularityUs < 0.0001 || granularityUs > 5000.0 {
+		return fmt.Errorf("timer granularity out of range")
 	}
+	return nil
+}
+
+func (v *Validator) validateScreenOrientation(orientation, orientationType string) error {
+	validOrientations := map[string]string{
+		"landscape-primary":   "landscape",
+		"landscape-secondary": "landscape",
+		"portrait-primary":    "portrait",
+		"portrait-secondary":  "portrait",
+		"unsupported":         "unsupported",
+	}
+
+	expectedType, ok := validOrientations[orientation]
+	if !ok {
+		return fmt.Errorf("screen orientation not recognized")
+	}
+
+	if orientationType != expectedType {
+		return fmt.Errorf("screen orientation type does not match orientation")
+	}
+
+	return nil
+}
+
+func (v *Validator) validateWASMInstantiationTime(ms int) error {
+	if ms < 0 || ms > 60000 {
+		return fmt.Errorf("WASM instantiation time out of range")
+	}
+	return nil
+}
+
+func (v *Validator) validateGPUMaxTextureSize(size *int) error {
+	if size == nil {
+		return nil
+	}
+
+	validSizes := []int{1024, 2048, 4096, 8192, 16384, 32768}
+	for _, valid := range validSizes {
+		if *size == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("GPU max texture size not valid")
+}
+
+func (v *Validator) validateIdleCallbackLatency(latency *int) error {
+	if latency == nil {
+		return nil
+	}
+
+	if *latency < 0 || *latency > 2000 {
+		return fmt.Errorf("idle callback latency out of range")
+	}
+	return nil
+}
+
+func (v *Validator) validateMediaQueryFingerprint(encoded string) error {
+	expectedBytes := (mediaQueryCount + 7) / 8
+	if len(encoded) != base64.StdEncoding.EncodedLen(expectedBytes) {
+		return fmt.Errorf("media query fingerprint length invalid")
+	}
+
+	bits, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(bits) != expectedBytes {
+		return fmt.Errorf("media query fingerprint encoding invalid")
+	}
+
+	if unused := expectedBytes*8 - mediaQueryCount; bits[expectedBytes-1]&(1<<uint(unused)-1) != 0 {
+		return fmt.Errorf("media query fingerprint has unused bits set")
+	}
+
+	return nil
+}
+
+func (v *Validator) validateCrossTabCommunication(active, broadcastChannelAvailable bool) error {
+	if active && !broadcastChannelAvailable {
+		return fmt.Errorf("cross-tab communication reported without BroadcastChannel support")
+	}
+	return nil
+}
+
+func (v *Validator) validateCSSAnimationTimingPrecision(precision *int) error {
+	if precision == nil {
+		return nil
+	}
+
+	if *precision < 0 || *precision > 100000 {
+		return fmt.Errorf("CSS animation timing precision out of range")
+	}
+	return nil
+}
+
+func (v *Validator) validateStorageEstimate(value *float64) error {
+	if value == nil {
+		return nil
+	}
+
+	if math.IsNaN(*value) || math.IsInf(*value, 0) || *value < 0 {
+		return fmt.Errorf("storage estimate must be a non-negative number")
+	}
+	return nil
+}
+
+func (v *Validator) validateSpeechVoices(count int, hash string) error {
+	if count < 0 || count > 1000 {
+		return fmt.Errorf("speech voice count out of range")
+	}
+
+	if hash == "none" {
+		if count != 0 {
+			return fmt.Errorf("speech voices reported without speech synthesis support")
+		}
+		return nil
+	}
+
+	if matched, _ := regexp.MatchString(`^[0-9a-f]{64}$`, hash); !matched {
+		return fmt.Errorf("speech voice hash format invalid")
+	}
+	return nil
+}
+
+func (v *Validator) validateServiceWorker(available, registered bool) error {
+	if registered && !available {
+		return fmt.Errorf("service worker registration reported without service worker support")
+	}
+	return nil
+}
+
+// Puppeteer, Playwright and Selenium all set navigator.webdriver unless
+// patched, so an honest automated browser is rejected outright.
+func (v *Validator) validateWebDriver(webDriver bool) error {
+	if webDriver {
+		return fmt.Errorf("navigator.webdriver is set")
+	}
+	return nil
+}
+
+func (v *Validator) validatePluginCount(count int) error {
+	if count < 0 || count > 100 {
+		return fmt.Errorf("plugin count out of range")
+	}
+	return nil
+}
+
+func (v *Validator) validateGPUTier(tier string) error {
+	switch tier {
+	case "tier-0", "tier-1", "tier-2", "tier-3", "unsupported":
+		return nil
+	}
+	return fmt.Errorf("GPU tier not recognized")
+}
+
+func (v *Validator) validatePageAge(seconds int) error {
+	if seconds < 0 || seconds > 86400 {
+		return fmt.Errorf("page age out of range")
+	}
+	return nil
+}
+
+func (v *Validator) validateSupportedMIMEHash(hash string) error {
+	if hash == "unsupported" {
+		return nil
+	}
+
+	if matched, _ := regexp.MatchString(`^[0-9a-f]{64}$`, hash); !matched {
+		return fmt.Errorf("supported MIME hash format invalid")
+	}
+	return nil
+}
+
+// An empty hash means ICE gathering had not finished when the fingerprint
+// was collected.
+func (v *Validator) validateRTCLocalIPHash(hash string) error {
+	if hash == "" || hash == "unsupported" {
+		return nil
+	}
+
+	if matched, _ := regexp.MatchString(`^[0-9a-f]{64}$`, hash); !matched {
+		return fmt.Errorf("WebRTC local IP hash format invalid")
+	}
+	return nil
+}
+
+func (v *Validator) validateCacheLatency(available bool, latencyMs *int) error {
+	if latencyMs == nil {
+		return nil
+	}
+	if !available {
+		return fmt.Errorf("cache latency reported without Cache API support")
+	}
+	if *latencyMs < 0 || *latencyMs > 60000 {
+		return fmt.Errorf("cache latency out of valid range")
+	}
+	return nil
+}
+
+// validateCSSSupport rejects feature combinations no shipped engine has had:
+// every browser with CSS grid already supported flexbox and custom properties.
+func (v *Validator) validateCSSSupport(customProperties, grid, flex bool) error {
+	if grid && (!flex || !customProperties) {
+		return fmt.Errorf("CSS grid reported without flexbox or custom property support")
+	}
+	return nil
+}
+
+func (v *Validator) validateClipboardContentHash(hash *string) error {
+	if hash == nil {
+		return nil
+	}
+
+	if matched, _ := regexp.MatchString(`^[0-9a-f]{64}$`, *hash); !matched {
+		return fmt.Errorf("clipboard content hash format invalid")
+	}
+	return nil
+}
+
+func (v *Validator) validateCanvasHash(hash string) error {
+	if hash == "unsupported" {
+		return nil
+	}
+
+	if matched, _ := regexp.MatchString(`^[0-9a-f]{64}$`, hash); !matched {
+		return fmt.Errorf("canvas hash format invalid")
+	}
+	if strings.Trim(hash, "0") == "" {
+		return fmt.Errorf("canvas hash is zero")
+	}
+	return nil
+}
 
+func (v *Validator) validateWebGL(renderer, vendor string, extensionCount int) error {
+	if renderer == "unavailable" || vendor == "unavailable" {
+		if renderer != vendor || extensionCount != 0 {
+			return fmt.Errorf("WebGL reported as both available and unavailable")
+		}
+		return nil
+	}
+
+	if extensionCount < 0 || extensionCount > 200 {
+		return fmt.Errorf("WebGL extension count out of range")
+	}
+	if len(renderer) > 256 || len(vendor) > 256 {
+		return fmt.Errorf("WebGL renderer or vendor too long")
+	}
+	if extensionCount > 0 && (strings.TrimSpace(renderer) == "" || strings.TrimSpace(vendor) == "") {
+		return fmt.Errorf("WebGL extensions reported without renderer or vendor")
+	}
 	return nil
-} 
\ No newline at end of file
+}
+
+func chromeMajorVersion(userAgent string) int {
+	match := chromeVersionPattern.FindStringSubmatch(userAgent)
+	if match == nil {
+		return 0
+	}
+	version, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return version
+}
@@ -0,0 +1,63 @@
+package fingerprint
+
+import (
+	"testing"
+
+	"captcha/internal/database"
+)
+
+const windowsChrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// touchLaptop is a real Windows touchscreen laptop at an uncommon zoom
+// level, with the widget open in a second tab.
+func touchLaptop() *database.FingerprintData {
+	return &database.FingerprintData{
+		UserAgent:                   windowsChrome,
+		Platform:                    "Win32",
+		MaxTouchPoints:              10,
+		PixelRatio:                  1.35,
+		Languages:                   []string{"en-GB", "en"},
+		PluginCount:                 5,
+		TimerGranularityUs:          100,
+		WASMInstantiationTimeMs:     30,
+		CrossTabCommunicationActive: true,
+		PageAgeSeconds:              45,
+		ServiceWorkerAvailable:      true,
+		PointerLockAvailable:        true,
+		FullscreenAvailable:         true,
+		CSSGridSupported:            true,
+	}
+}
+
+func TestScoreKeepsRealDevicesBelowDefaultThreshold(t *testing.T) {
+	v := &Validator{}
+
+	fp := touchLaptop()
+	if score := v.Score(fp); score >= 0.7 {
+		t.Errorf("touchscreen laptop scored %.2f, want below 0.7", score)
+	}
+
+	fp.DoNotTrack = "1"
+	fp.FingerprintResistanceDetected = true
+	fp.TimerGranularityUs = 1000
+	if score := v.Score(fp); score >= 0.7 {
+		t.Errorf("privacy-hardened touchscreen laptop scored %.2f, want below 0.7", score)
+	}
+}
+
+func TestScoreRejectsHeadlessChrome(t *testing.T) {
+	v := &Validator{}
+
+	fp := touchLaptop()
+	fp.Platform = "Linux x86_64"
+	fp.MaxTouchPoints = 0
+	fp.PixelRatio = 1
+	fp.Languages = []string{"en-US"}
+	fp.PluginCount = 0
+	fp.PageAgeSeconds = 0
+	fp.ServiceWorkerAvailable = false
+
+	if score := v.Score(fp); score <= 0.7 {
+		t.Errorf("headless Chrome scored %.2f, want above 0.7", score)
+	}
+}
@@ -0,0 +1,695 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"captcha/internal/argon2"
+	"captcha/internal/config"
+	"captcha/internal/database"
+	"captcha/internal/fingerprint"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const adminUsername = "admin"
+
+type AdminHandler struct {
+	cfg                  *atomic.Pointer[config.Config]
+	db                   *database.DB
+	argon2Service        *argon2.Service
+	fingerprintValidator *fingerprint.Validator
+}
+
+func NewAdminHandler(cfg *atomic.Pointer[config.Config], db *database.DB, argon2Service *argon2.Service, fingerprintValidator *fingerprint.Validator) *AdminHandler {
+	return &AdminHandler{
+		cfg:                  cfg,
+		db:                   db,
+		argon2Service:        argon2Service,
+		fingerprintValidator: fingerprintValidator,
+	}
+}
+
+func (h *AdminHandler) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.authorized(r) {
+			if h.cfg.Load().AdminPasswordHash != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="captcha admin"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	key := r.Header.Get("X-Admin-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && key == "" {
+		key = bearer
+	}
+	if key != "" {
+		return h.cfg.Load().AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(h.cfg.Load().AdminAPIKey)) == 1
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || h.cfg.Load().AdminPasswordHash == "" {
+		return false
+	}
+
+	if r.TLS == nil && r.Header.Get("X-Forwarded-Proto") != "https" {
+		slog.WarnContext(r.Context(), "Admin Basic Auth used without TLS", "client_ip", GetClientIP(r, h.cfg.Load().TrustedProxyNets))
+	}
+
+	if subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername)) != 1 {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(h.cfg.Load().AdminPasswordHash), []byte(password)) == nil
+}
+
+type CleanupResponse struct {
+	ChallengesDeleted int64 `json:"challenges_deleted"`
+	SolutionsDeleted  int64 `json:"solutions_deleted"`
+}
+
+func (h *AdminHandler) CleanupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var olderThan time.Duration
+	if value := r.URL.Query().Get("olderThan"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid olderThan duration", http.StatusBadRequest)
+			return
+		}
+		olderThan = parsed
+	}
+
+	var solutionsDeleted int64
+	if olderThan > 0 {
+		var err error
+		solutionsDeleted, err = h.db.CleanupOldSolutions(olderThan)
+		if err != nil {
+			http.Error(w, "Failed to cleanup old solutions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := h.db.ApplyRetentionPolicy(h.cfg.Load().Retention)
+	if err != nil {
+		http.Error(w, "Failed to apply retention policy", http.StatusInternalServerError)
+		return
+	}
+
+	response := CleanupResponse{
+		ChallengesDeleted: result.ChallengesSolved + result.ChallengesExpired,
+		SolutionsDeleted:  solutionsDeleted + result.SolutionsValid + result.SolutionsInvalid,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const maxAuditQueryLength = 256
+
+type AuditSearchResponse struct {
+	Entries []*database.AuditEntry `json:"entries"`
+	Page    int                    `json:"page"`
+	Limit   int                    `json:"limit"`
+}
+
+func (h *AdminHandler) AuditSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" || len(query) > maxAuditQueryLength {
+		http.Error(w, fmt.Sprintf("Query must be between 1 and %d characters", maxAuditQueryLength), http.StatusBadRequest)
+		return
+	}
+
+	page, limit, ok := parsePagination(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.db.SearchAuditLog(query, page, limit)
+	if err != nil {
+		http.Error(w, "Failed to search audit log", http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []*database.AuditEntry{}
+	}
+
+	response := AuditSearchResponse{
+		Entries: entries,
+		Page:    page,
+		Limit:   limit,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type KeyAuditResponse struct {
+	Entries []*database.ConfigAuditEntry `json:"entries"`
+	Page    int                          `json:"page"`
+	Limit   int                          `json:"limit"`
+}
+
+func (h *AdminHandler) KeyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, limit, ok := parsePagination(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.db.GetConfigAudit(page, limit)
+	if err != nil {
+		http.Error(w, "Failed to load key audit trail", http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []*database.ConfigAuditEntry{}
+	}
+
+	response := KeyAuditResponse{
+		Entries: entries,
+		Page:    page,
+		Limit:   limit,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const (
+	defaultBenchmarkIterations = 5
+	maxBenchmarkIterations     = 50
+)
+
+type BenchmarkResponse struct {
+	Iterations      int     `json:"iterations"`
+	HashesPerSecond float64 `json:"hashesPerSecond"`
+}
+
+func (h *AdminHandler) BenchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	iterations := defaultBenchmarkIterations
+	if value := r.URL.Query().Get("iterations"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxBenchmarkIterations {
+			http.Error(w, fmt.Sprintf("iterations must be between 1 and %d", maxBenchmarkIterations), http.StatusBadRequest)
+			return
+		}
+		iterations = parsed
+	}
+
+	hashesPerSecond, err := h.argon2Service.Benchmark(iterations)
+	if err != nil {
+		http.Error(w, "Failed to run benchmark", http.StatusInternalServerError)
+		return
+	}
+
+	response := BenchmarkResponse{
+		Iterations:      iterations,
+		HashesPerSecond: hashesPerSecond,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type FingerprintValidateRequest struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+type FingerprintValidateResponse struct {
+	Overall string            `json:"overall"`
+	Fields  map[string]string `json:"fields"`
+}
+
+func (h *AdminHandler) FingerprintValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FingerprintValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Fingerprint == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	fields, valid, err := h.fingerprintValidator.ValidateFieldsReport(req.Fingerprint)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := FingerprintValidateResponse{
+		Overall: "valid",
+		Fields:  fields,
+	}
+	if !valid {
+		response.Overall = "invalid"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const (
+	defaultFingerprintHealthDays = 7
+	maxFingerprintHealthDays     = 90
+)
+
+type FingerprintHealthResponse struct {
+	Days     int                                `json:"days"`
+	Failures []*database.FingerprintFailureStat `json:"failures"`
+}
+
+func (h *AdminHandler) FingerprintHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultFingerprintHealthDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxFingerprintHealthDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxFingerprintHealthDays), http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	failures, err := h.db.GetFingerprintFailureStats(days)
+	if err != nil {
+		http.Error(w, "Failed to load fingerprint failure stats", http.StatusInternalServerError)
+		return
+	}
+
+	if failures == nil {
+		failures = []*database.FingerprintFailureStat{}
+	}
+
+	response := FingerprintHealthResponse{
+		Days:     days,
+		Failures: failures,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const (
+	defaultStatsWindow = 24 * time.Hour
+	maxStatsWindow     = 30 * 24 * time.Hour
+)
+
+// statsGranularities maps the granularity parameter to a DATE_TRUNC unit.
+var statsGranularities = map[string]string{
+	"1h":  "hour",
+	"24h": "day",
+	"7d":  "week",
+}
+
+type StatsResponse struct {
+	Window      string            `json:"window"`
+	Granularity string            `json:"granularity,omitempty"`
+	Filter      map[string]string `json:"filter,omitempty"`
+	*database.Stats
+}
+
+// StatsHandler accepts a single meta[key]=value parameter to scope the
+// numbers to challenges tagged through the metadata endpoint.
+func (h *AdminHandler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := defaultStatsWindow
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxStatsWindow {
+			http.Error(w, "window must be a positive duration of at most 720h", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	granularity := r.URL.Query().Get("granularity")
+	bucketUnit, ok := statsGranularities[granularity]
+	if granularity != "" && !ok {
+		http.Error(w, "granularity must be 1h, 24h or 7d", http.StatusBadRequest)
+		return
+	}
+
+	var filter database.StatsFilter
+	for param, values := range r.URL.Query() {
+		if !strings.HasPrefix(param, "meta[") || !strings.HasSuffix(param, "]") {
+			continue
+		}
+		if filter.MetaKey != "" || len(values) != 1 {
+			http.Error(w, "Only one meta filter is supported", http.StatusBadRequest)
+			return
+		}
+		filter.MetaKey = strings.TrimSuffix(strings.TrimPrefix(param, "meta["), "]")
+		filter.MetaValue = values[0]
+	}
+	if filter.MetaKey != "" {
+		if err := validateMetadata(map[string]string{filter.MetaKey: filter.MetaValue}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := h.db.GetStats(window, bucketUnit, filter)
+	if err != nil {
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	response := StatsResponse{
+		Window:      window.String(),
+		Granularity: granularity,
+		Stats:       stats,
+	}
+	if filter.MetaKey != "" {
+		response.Filter = map[string]string{filter.MetaKey: filter.MetaValue}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const (
+	defaultDifficultyHistoryRange = 24 * time.Hour
+	maxDifficultyHistoryRange     = 90 * 24 * time.Hour
+)
+
+type DifficultyHistoryResponse struct {
+	Start     time.Time                      `json:"start"`
+	End       time.Time                      `json:"end"`
+	Snapshots []*database.DifficultySnapshot `json:"snapshots"`
+}
+
+func (h *AdminHandler) DifficultyHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	end := time.Now()
+	if value := r.URL.Query().Get("end"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "end must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		end = parsed
+	}
+
+	start := end.Add(-defaultDifficultyHistoryRange)
+	if value := r.URL.Query().Get("start"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "start must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		start = parsed
+	}
+
+	if !start.Before(end) || end.Sub(start) > maxDifficultyHistoryRange {
+		http.Error(w, "start must be before end and at most 90 days earlier", http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := h.db.GetDifficultyHistory(start, end)
+	if err != nil {
+		http.Error(w, "Failed to load difficulty history", http.StatusInternalServerError)
+		return
+	}
+
+	if snapshots == nil {
+		snapshots = []*database.DifficultySnapshot{}
+	}
+
+	response := DifficultyHistoryResponse{
+		Start:     start,
+		End:       end,
+		Snapshots: snapshots,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AdminHandler) IPHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := mux.Vars(r)["ip"]
+	if net.ParseIP(ip) == nil {
+		http.Error(w, "Invalid IP address", http.StatusBadRequest)
+		return
+	}
+
+	_, limit, ok := parsePagination(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.db.GetIPHistory(ip, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, database.ErrUnknownCursor) {
+		http.Error(w, "Unknown cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load IP history", http.StatusInternalServerError)
+		return
+	}
+
+	if history.Solutions == nil {
+		history.Solutions = []*database.Solution{}
+	}
+	if history.RiskScores == nil {
+		history.RiskScores = []*database.RiskScoreSample{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+func parsePagination(r *http.Request) (int, int, bool) {
+	page, limit := 1, 50
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, 0, false
+		}
+		page = parsed
+	}
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 200 {
+			return 0, 0, false
+		}
+		limit = parsed
+	}
+
+	return page, limit, true
+}
+
+type ChallengeMetadataRequest struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+type ChallengeMetadataResponse struct {
+	ID       string            `json:"id"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (h *AdminHandler) UpdateChallengeMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challengeID := mux.Vars(r)["id"]
+
+	var req ChallengeMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateMetadata(req.Metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := h.db.UpdateChallengeMetadata(challengeID, req.Metadata)
+	if err != nil {
+		http.Error(w, "Failed to update challenge metadata", http.StatusInternalServerError)
+		return
+	}
+
+	if metadata == nil {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+
+	response := ChallengeMetadataResponse{
+		ID:       challengeID,
+		Metadata: metadata,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return fmt.Errorf("metadata cannot be empty")
+	}
+
+	if len(metadata) > database.MaxMetadataKeys {
+		return fmt.Errorf("metadata may contain at most %d keys", database.MaxMetadataKeys)
+	}
+
+	for key, value := range metadata {
+		if key == "" || len(key) > database.MaxMetadataKeyLength {
+			return fmt.Errorf("metadata keys must be between 1 and %d characters", database.MaxMetadataKeyLength)
+		}
+		if len(value) > database.MaxMetadataValueLength {
+			return fmt.Errorf("metadata values must be at most %d characters", database.MaxMetadataValueLength)
+		}
+	}
+
+	return nil
+}
+
+const hintNonceLength = 16
+
+type HintResponse struct {
+	ChallengeID          string `json:"challengeId"`
+	Nonce                string `json:"nonce"`
+	HashDigest           string `json:"hashDigest"`
+	Target               string `json:"target"`
+	MatchingPrefixLength int    `json:"matchingPrefixLength"`
+}
+
+func (h *AdminHandler) HintHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	noncePrefix := r.URL.Query().Get("nonce_prefix")
+	if noncePrefix == "" || len(noncePrefix) > hintNonceLength || !isAlphanumeric(noncePrefix) {
+		http.Error(w, fmt.Sprintf("nonce_prefix must be 1 to %d alphanumeric characters", hintNonceLength), http.StatusBadRequest)
+		return
+	}
+
+	challengeID := mux.Vars(r)["id"]
+	challenge, err := h.db.GetChallenge(challengeID)
+	if err != nil {
+		http.Error(w, "Failed to load challenge", http.StatusInternalServerError)
+		return
+	}
+
+	if challenge == nil || challenge.Solved || time.Now().After(challenge.ExpiresAt) {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+
+	nonce := noncePrefix + strings.Repeat("0", hintNonceLength-len(noncePrefix))
+	hash, err := h.argon2Service.ComputeHash(challenge, nonce)
+	if err != nil {
+		http.Error(w, "Failed to compute hash", http.StatusInternalServerError)
+		return
+	}
+
+	response := HintResponse{
+		ChallengeID:          challenge.ID,
+		Nonce:                nonce,
+		HashDigest:           hashDigest(hash),
+		Target:               challenge.Target,
+		MatchingPrefixLength: argon2.MatchingPrefixLength(hash, challenge.Target),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AdminHandler) PoolStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, ok := h.argon2Service.ChallengePoolStatus()
+	if !ok {
+		http.Error(w, "Challenge pool is disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// hashDigest lets an operator compare their solver's output without the
+// endpoint handing out hashes that could be submitted as solutions.
+func hashDigest(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAlphanumeric(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,35 +1,144 @@
 package handlers
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"mime"
 	"net"
 	"net/http"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"captcha/internal/argon2"
 	"captcha/internal/config"
+	"captcha/internal/crypto"
+	"captcha/internal/database"
 	"captcha/internal/fingerprint"
+	"captcha/internal/tls"
+	"captcha/internal/webhook"
+	"captcha/internal/middleware"
+	"captcha/pkg/token"
+
+	"github.com/gorilla/mux"
 )
 
+const maxTrackedChallengeIPs = 10000
+
 type Handler struct {
-	cfg               *config.Config
+	cfg               *atomic.Pointer[config.Config]
 	argon2Service     *argon2.Service
 	fingerprintValidator *fingerprint.Validator
-	aesKey            []byte
+	aesKeys           *crypto.KeyStore
+	db                *database.DB
+	sealer            *token.Sealer
+
+	issuedMu sync.Mutex
+	issued   map[string]*database.Challenge
+
+	certChecker *tls.CertExpiryChecker
+
+	solutionKey ed25519.PrivateKey
+	tokenIssuer *TokenIssuer
+
+	logger *slog.Logger
+
+	webhook *webhook.Dispatcher
 }
 
-func NewHandler(cfg *config.Config, argon2Service *argon2.Service, fingerprintValidator *fingerprint.Validator, aesKey []byte) *Handler {
+func NewHandler(cfg *atomic.Pointer[config.Config], db *database.DB, argon2Service *argon2.Service, fingerprintValidator *fingerprint.Validator, aesKeys *crypto.KeyStore, sealer *token.Sealer) *Handler {
+	var certChecker *tls.CertExpiryChecker
+	if certFile := cfg.Load().TLSCertFile; certFile != "" {
+		certChecker = tls.NewCertExpiryChecker(certFile)
+	}
+
 	return &Handler{
 		cfg:               cfg,
 		argon2Service:     argon2Service,
 		fingerprintValidator: fingerprintValidator,
-		aesKey:            aesKey,
+		aesKeys:           aesKeys,
+		db:                db,
+		sealer:            sealer,
+		issued:            make(map[string]*database.Challenge),
+		logger:            slog.Default(),
+		certChecker:       certChecker,
 	}
 }
 
+// SetSolutionSigningKey enables detached signatures on successful
+// verifications. A nil key disables them.
+func (h *Handler) SetSolutionSigningKey(key ed25519.PrivateKey) {
+	h.solutionKey = key
+}
+
+// SetLogger replaces the default logger. Call it before serving requests.
+func (h *Handler) SetLogger(logger *slog.Logger) {
+	h.logger = logger
+}
+
+// SetWebhookDispatcher enables solve callbacks. A nil dispatcher disables
+// them.
+func (h *Handler) SetWebhookDispatcher(dispatcher *webhook.Dispatcher) {
+	h.webhook = dispatcher
+}
+
+// SetTokenIssuer enables JWTs on successful verifications. A nil issuer
+// disables them.
+func (h *Handler) SetTokenIssuer(issuer *TokenIssuer) {
+	h.tokenIssuer = issuer
+}
+
 type ChallengeResponse struct {
-	Challenge interface{} `json:"challenge"`
+	Challenge PublicChallenge `json:"challenge"`
+}
+
+type PublicChallenge struct {
+	ID         string     `json:"id"`
+	Salt       string     `json:"salt"`
+	Difficulty uint32     `json:"difficulty"`
+	Memory     uint32     `json:"memory"`
+	Threads    uint8      `json:"threads"`
+	KeyLen     uint32     `json:"keyLen"`
+	Target     string     `json:"target"`
+	Algorithm  string     `json:"algorithm"`
+	Variant    string     `json:"variant,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+
+	ExpirySignature string `json:"expirySignature,omitempty"`
+
+	EstimatedSolveMs int64 `json:"estimatedSolveMs"`
+}
+
+func (h *Handler) publicChallenge(challenge *database.Challenge) PublicChallenge {
+	public := PublicChallenge{
+		ID:         challenge.ID,
+		Salt:       challenge.Salt,
+		Difficulty: challenge.Difficulty,
+		Memory:     challenge.Memory,
+		Threads:    challenge.Threads,
+		KeyLen:     challenge.KeyLen,
+		Target:     challenge.Target,
+		Algorithm:  challenge.Algorithm,
+		Variant:    challenge.Variant,
+
+		EstimatedSolveMs: h.argon2Service.EstimateSolveTime(challenge).Milliseconds(),
+	}
+
+	if h.cfg.Load().IncludeChallengeExpiry {
+		expiresAt := challenge.ExpiresAt
+		public.ExpiresAt = &expiresAt
+		public.ExpirySignature = challenge.ExpirySignature
+	}
+
+	return public
 }
 
 type VerifyRequest struct {
@@ -37,33 +146,269 @@ type VerifyRequest struct {
 	Nonce       string `json:"nonce"`
 	Hash        string `json:"hash"`
 	Fingerprint string `json:"fingerprint"`
+
+	SessionToken string `json:"sessionToken,omitempty"`
 }
 
 type VerifyResponse struct {
-	Valid   bool   `json:"valid"`
-	Message string `json:"message,omitempty"`
+	Valid       bool    `json:"valid"`
+	Message     string  `json:"message,omitempty"`
+	RiskScore   float64 `json:"riskScore"`
+	BotScore    float64 `json:"botScore"`
+	SealedToken string  `json:"sealedToken,omitempty"`
+	SupportCode string  `json:"supportCode,omitempty"`
+
+	SolutionID        string `json:"solutionId,omitempty"`
+	SolvedAt          int64  `json:"solvedAt,omitempty"`
+	FingerprintHash   string `json:"fingerprintHash,omitempty"`
+	SolutionSignature string `json:"solutionSignature,omitempty"`
+
+	Token string `json:"token,omitempty"`
+}
+
+const MaxVerifyBatchSize = 50
+
+type VerifyBatchRequest struct {
+	Requests []VerifyRequest `json:"requests"`
 }
 
+type VerifyBatchResponse struct {
+	Results []VerifyResponse `json:"results"`
+}
+
+type ChallengeRequest struct {
+	SessionToken string `json:"sessionToken"`
+}
+
+type ChallengeBatchRequest struct {
+	Count        int    `json:"count"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type ChallengeBatchResponse struct {
+	Challenges []PublicChallenge `json:"challenges"`
+}
+
+// maxSessionTokenLength bounds the token accepted on POST /challenge; it is
+// hashed before storage, so the limit only guards the request body.
+const maxSessionTokenLength = 4096
+
 func (h *Handler) ChallengeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var sessionToken string
+	if r.Method == http.MethodPost {
+		var req ChallengeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSessionTokenLength+64)).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.SessionToken == "" || len(req.SessionToken) > maxSessionTokenLength {
+			http.Error(w, "Invalid session token", http.StatusBadRequest)
+			return
+		}
+		sessionToken = req.SessionToken
+	}
+
+	clientIP := h.getClientIP(r)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if h.rejectBlocked(r.Context(), w, clientIP) {
+		return
+	}
+
+	if h.rejectOverQuota(r.Context(), w, clientIP, 1) {
+		return
+	}
+
+	switch r.URL.Query().Get("type") {
+	case "", database.ChallengeTypeStandard:
+	case database.ChallengeTypeHoneypot:
+		h.honeypotChallenge(r.Context(), w, clientIP)
+		return
+	default:
+		http.Error(w, "Unknown challenge type", http.StatusBadRequest)
+		return
+	}
+
+	// A session-bound challenge is never reused for a conditional request,
+	// since the last challenge issued to the IP may belong to another session.
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && sessionToken == "" {
+		if last := h.lastIssuedChallenge(clientIP); last != nil && etagMatches(ifNoneMatch, challengeETag(last.ID)) {
+			if active, err := h.argon2Service.IsChallengeActive(last.ID); err == nil && active {
+				w.Header().Set("ETag", challengeETag(last.ID))
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	challenge, err := h.argon2Service.GenerateChallenge(r.Context(), h.cfg.Load().ServerLocation, clientIP, sessionToken)
+	if err != nil {
+		http.Error(w, "Failed to generate challenge", http.StatusInternalServerError)
+		return
+	}
+
+	h.trackIssuedChallenge(clientIP, challenge)
+
+	response := ChallengeResponse{
+		Challenge: h.publicChallenge(challenge),
+	}
+
+	w.Header().Set("ETag", challengeETag(challenge.ID))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ChallengeBatchHandler issues several standard challenges at once, for
+// pages with more than one widget. Each counts against the IP quota.
+func (h *Handler) ChallengeBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	challenge, err := h.argon2Service.GenerateChallenge()
+	var req ChallengeBatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSessionTokenLength+64)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Count < 1 || req.Count > h.cfg.Load().ChallengeBatchMax {
+		http.Error(w, fmt.Sprintf("Count must be between 1 and %d", h.cfg.Load().ChallengeBatchMax), http.StatusBadRequest)
+		return
+	}
+	if len(req.SessionToken) > maxSessionTokenLength {
+		http.Error(w, "Invalid session token", http.StatusBadRequest)
+		return
+	}
+
+	clientIP := h.getClientIP(r)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if h.rejectBlocked(r.Context(), w, clientIP) {
+		return
+	}
+
+	if h.rejectOverQuota(r.Context(), w, clientIP, req.Count) {
+		return
+	}
+
+	challenges, err := h.argon2Service.GenerateChallenges(r.Context(), h.cfg.Load().ServerLocation, clientIP, req.SessionToken, req.Count)
+	if err != nil {
+		http.Error(w, "Failed to generate challenges", http.StatusInternalServerError)
+		return
+	}
+
+	response := ChallengeBatchResponse{Challenges: make([]PublicChallenge, len(challenges))}
+	for i, challenge := range challenges {
+		response.Challenges[i] = h.publicChallenge(challenge)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// honeypotChallenge skips ETag tracking so a honeypot never replaces the
+// client's real challenge for conditional requests.
+func (h *Handler) honeypotChallenge(ctx context.Context, w http.ResponseWriter, clientIP string) {
+	challenge, err := h.argon2Service.GenerateHoneypotChallenge(ctx, h.cfg.Load().ServerLocation, clientIP)
 	if err != nil {
 		http.Error(w, "Failed to generate challenge", http.StatusInternalServerError)
 		return
 	}
 
 	response := ChallengeResponse{
-		Challenge: challenge,
+		Challenge: h.publicChallenge(challenge),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+const challengeQuotaWindow = time.Hour
+
+// rejectOverQuota caps stored challenges per IP, refusing a request for n
+// more that would exceed it. Unlike the token bucket in front of the router
+// it cannot be burst past, since it counts rows.
+func (h *Handler) rejectOverQuota(ctx context.Context, w http.ResponseWriter, clientIP string, n int) bool {
+	if h.cfg.Load().MaxChallengesPerIPPerHour <= 0 {
+		return false
+	}
+
+	count, err := h.db.CountChallengesFromIP(clientIP, time.Now().Add(-challengeQuotaWindow))
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count challenges for IP", "client_ip", clientIP, "error", err)
+		return false
+	}
+
+	if count+n > h.cfg.Load().MaxChallengesPerIPPerHour {
+		w.Header().Set("Retry-After", strconv.Itoa(int(challengeQuotaWindow.Seconds())))
+		http.Error(w, "Challenge quota exceeded", http.StatusTooManyRequests)
+		return true
+	}
+	return false
+}
+
+func (h *Handler) rejectBlocked(ctx context.Context, w http.ResponseWriter, clientIP string) bool {
+	blocked, err := h.db.IsIPBlocked(clientIP)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to check IP blocklist", "client_ip", clientIP, "error", err)
+		return false
+	}
+
+	if blocked {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}
+	return blocked
+}
+
+func (h *Handler) lastIssuedChallenge(clientIP string) *database.Challenge {
+	h.issuedMu.Lock()
+	defer h.issuedMu.Unlock()
+
+	challenge, ok := h.issued[clientIP]
+	if !ok || time.Now().After(challenge.ExpiresAt) {
+		return nil
+	}
+	return challenge
+}
+
+func (h *Handler) trackIssuedChallenge(clientIP string, challenge *database.Challenge) {
+	h.issuedMu.Lock()
+	defer h.issuedMu.Unlock()
+
+	if len(h.issued) >= maxTrackedChallengeIPs {
+		now := time.Now()
+		for ip, c := range h.issued {
+			if now.After(c.ExpiresAt) {
+				delete(h.issued, ip)
+			}
+		}
+		if len(h.issued) >= maxTrackedChallengeIPs {
+			return
+		}
+	}
+
+	h.issued[clientIP] = challenge
+}
+
+func challengeETag(challengeID string) string {
+	return `"` + challengeID + `"`
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handler) VerifyHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -71,58 +416,491 @@ func (h *Handler) VerifyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req VerifyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if isMultipartForm(r) {
+		if err := r.ParseMultipartForm(maxVerifyFormMemory); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		req = VerifyRequest{
+			ChallengeID: r.FormValue("challengeId"),
+			Nonce:       r.FormValue("nonce"),
+			Hash:        r.FormValue("hash"),
+			Fingerprint: r.FormValue("fingerprint"),
+
+			SessionToken: r.FormValue("sessionToken"),
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !h.argon2Service.ValidChallengeID(req.ChallengeID) {
+		http.Error(w, "Invalid challenge ID", http.StatusBadRequest)
+		return
+	}
+
 	clientIP := h.getClientIP(r)
 	userAgent := r.Header.Get("User-Agent")
 
-	fingerprintData, err := h.fingerprintValidator.ValidateFingerprint(req.Fingerprint)
+	if h.rejectBlocked(r.Context(), w, clientIP) {
+		return
+	}
+
+	response, err := h.verifyRequest(r.Context(), req, nil, clientIP, userAgent, h.backendRequest(r, clientIP))
+	if errors.Is(err, argon2.ErrReplay) {
+		http.Error(w, "Solution already submitted", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		response := VerifyResponse{
-			Valid:   false,
-			Message: "Fingerprint validation failed",
+		code := h.logSupportCode(r.Context(), "internal_error", err, req.ChallengeID, clientIP)
+		http.Error(w, fmt.Sprintf("Internal error (support code %s)", code), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxVerifyFormMemory bounds how much of a multipart verify submission is
+// held in memory; the fields are short strings, so nothing should spill.
+const maxVerifyFormMemory = 32 << 10
+
+func isMultipartForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// verifyBatchLimit keeps batches within the verify rate limit's burst. Each
+// item is charged against it, so a larger batch could never be admitted.
+func (h *Handler) verifyBatchLimit() int {
+	if limit := h.cfg.Load().VerifyRateLimitRequests; limit < MaxVerifyBatchSize {
+		return limit
+	}
+	return MaxVerifyBatchSize
+}
+
+func (h *Handler) VerifyBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req VerifyBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if maxSize := h.verifyBatchLimit(); len(req.Requests) == 0 || len(req.Requests) > maxSize {
+		http.Error(w, fmt.Sprintf("Batch must contain between 1 and %d requests", maxSize), http.StatusBadRequest)
+		return
+	}
+
+	clientIP := h.getClientIP(r)
+	userAgent := r.Header.Get("User-Agent")
+
+	if h.rejectBlocked(r.Context(), w, clientIP) {
+		return
+	}
+
+	ids := make([]string, 0, len(req.Requests))
+	seen := make(map[string]bool, len(req.Requests))
+	duplicate := make([]bool, len(req.Requests))
+	invalidID := make([]bool, len(req.Requests))
+	for i, item := range req.Requests {
+		if !h.argon2Service.ValidChallengeID(item.ChallengeID) {
+			invalidID[i] = true
+			continue
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		if seen[item.ChallengeID] {
+			duplicate[i] = true
+			continue
+		}
+		seen[item.ChallengeID] = true
+		ids = append(ids, item.ChallengeID)
+	}
+
+	challenges, err := h.argon2Service.GetChallenges(ids)
+	if err != nil {
+		http.Error(w, "Failed to load challenges", http.StatusInternalServerError)
 		return
 	}
 
-	fingerprintJSON, err := json.Marshal(fingerprintData)
+	fromBackend := h.backendRequest(r, clientIP)
+	results := make([]VerifyResponse, len(req.Requests))
+	indexes := make(chan int)
+
+	workers := runtime.NumCPU()
+	if workers > len(req.Requests) {
+		workers = len(req.Requests)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				if invalidID[idx] {
+					results[idx] = VerifyResponse{
+						Valid:   false,
+						Message: "Invalid challenge ID",
+					}
+					continue
+				}
+				if duplicate[idx] {
+					results[idx] = VerifyResponse{
+						Valid:       false,
+						Message:     "Duplicate challenge in batch",
+						SupportCode: h.logSupportCode(r.Context(), "duplicate_challenge", nil, req.Requests[idx].ChallengeID, clientIP),
+					}
+					continue
+				}
+
+				response, err := h.verifyRequest(r.Context(), req.Requests[idx], challenges, clientIP, userAgent, fromBackend)
+				if errors.Is(err, argon2.ErrReplay) {
+					response = VerifyResponse{
+						Valid:       false,
+						Message:     "Solution already submitted",
+						SupportCode: h.logSupportCode(r.Context(), "replay", err, req.Requests[idx].ChallengeID, clientIP),
+					}
+				} else if err != nil {
+					response = VerifyResponse{
+						Valid:       false,
+						Message:     "Internal error",
+						SupportCode: h.logSupportCode(r.Context(), "internal_error", err, req.Requests[idx].ChallengeID, clientIP),
+					}
+				}
+				results[idx] = response
+			}
+		}()
+	}
+
+	for i := range req.Requests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VerifyBatchResponse{Results: results})
+}
+
+// backendRequest reports whether an integrator's server, rather than the
+// browser that solved the challenge, is verifying. Only a valid request
+// signature or a BACKEND_CIDRS address counts; headers anyone can set do
+// not.
+func (h *Handler) backendRequest(r *http.Request, clientIP string) bool {
+	return middleware.Signed(r.Context()) || ipTrusted(clientIP, h.cfg.Load().BackendNets)
+}
+
+// blockHoneypotSubmitter blocks clientIP, which GetClientIP only takes from
+// forwarded headers set by a trusted proxy.
+func (h *Handler) blockHoneypotSubmitter(ctx context.Context, clientIP string) {
+	ttl := time.Duration(h.cfg.Load().HoneypotBlockHours) * time.Hour
+	if err := h.db.BlockIP(clientIP, "honeypot_triggered", ttl); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to block honeypot submitter", "client_ip", clientIP, "error", err)
+	}
+}
+
+func (h *Handler) verifyRequest(ctx context.Context, req VerifyRequest, challenges map[string]*database.Challenge, clientIP, userAgent string, fromBackend bool) (VerifyResponse, error) {
+	response, err := h.verifyChallengeRequest(ctx, req, challenges, clientIP, userAgent, fromBackend)
+	if err == nil {
+		h.audit(ctx, "verify", clientIP, userAgent, map[string]interface{}{
+			"challengeId": req.ChallengeID,
+			"valid":       response.Valid,
+			"message":     response.Message,
+			"riskScore":   response.RiskScore,
+		})
+	}
+	return response, err
+}
+
+func (h *Handler) audit(ctx context.Context, eventType, clientIP, userAgent string, metadata map[string]interface{}) {
+	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
-		http.Error(w, "Failed to serialize fingerprint", http.StatusInternalServerError)
+		h.logger.ErrorContext(ctx, "Failed to serialize audit metadata", "event", eventType, "client_ip", clientIP, "error", err)
 		return
 	}
 
-	solution, err := h.argon2Service.VerifySolution(
-		req.ChallengeID,
-		req.Nonce,
-		req.Hash,
-		string(fingerprintJSON),
-		clientIP,
-		userAgent,
-	)
+	entry := &database.AuditEntry{
+		EventType: eventType,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		Metadata:  string(metadataJSON),
+	}
+
+	if err := h.db.WriteAuditEntry(entry); err != nil {
+		h.logger.ErrorContext(ctx, "Failed to write audit entry", "event", eventType, "client_ip", clientIP, "error", err)
+	}
+}
+
+func (h *Handler) verifyChallengeRequest(ctx context.Context, req VerifyRequest, challenges map[string]*database.Challenge, clientIP, userAgent string, fromBackend bool) (VerifyResponse, error) {
+	fingerprintData, err := h.fingerprintValidator.ValidateFingerprint(req.Fingerprint)
+	if err != nil {
+		return VerifyResponse{
+			Valid:       false,
+			Message:     "Fingerprint validation failed",
+			SupportCode: h.logSupportCode(ctx, "fingerprint_invalid", err, req.ChallengeID, clientIP),
+		}, nil
+	}
+
+	riskScore := h.fingerprintValidator.Score(fingerprintData)
 
+	if threshold := h.cfg.Load().FingerprintRejectScoreThreshold; riskScore > threshold {
+		err := fmt.Errorf("bot score %.2f exceeds threshold %.2f", riskScore, threshold)
+		return VerifyResponse{
+			Valid:       false,
+			Message:     "Verification failed",
+			RiskScore:   riskScore,
+			BotScore:    riskScore,
+			SupportCode: h.logSupportCode(ctx, "bot_score", err, req.ChallengeID, clientIP),
+		}, nil
+	}
+
+	fingerprintJSON, err := json.Marshal(fingerprintData)
 	if err != nil {
-		response := VerifyResponse{
-			Valid:   false,
-			Message: fmt.Sprintf("Verification failed: %s", err.Error()),
+		return VerifyResponse{}, fmt.Errorf("Failed to serialize fingerprint")
+	}
+
+	platform := fingerprint.NormalizePlatform(fingerprintData.Platform)
+
+	var solution *database.Solution
+	if challenges != nil {
+		solution, err = h.argon2Service.VerifySolutionWithChallenge(
+			ctx,
+			challenges[req.ChallengeID],
+			req.ChallengeID,
+			req.Nonce,
+			req.Hash,
+			req.SessionToken,
+			string(fingerprintJSON),
+			platform,
+			clientIP,
+			userAgent,
+		)
+	} else {
+		solution, err = h.argon2Service.VerifySolution(
+			ctx,
+			req.ChallengeID,
+			req.Nonce,
+			req.Hash,
+			req.SessionToken,
+			string(fingerprintJSON),
+			platform,
+			clientIP,
+			userAgent,
+		)
+	}
+
+	if errors.Is(err, argon2.ErrHoneypotTriggered) {
+		if !fromBackend {
+			h.blockHoneypotSubmitter(ctx, clientIP)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-		return
+		return VerifyResponse{
+			Valid:       false,
+			Message:     "Invalid solution",
+			RiskScore:   riskScore,
+			BotScore:    riskScore,
+			SupportCode: h.logSupportCode(ctx, "honeypot_triggered", err, req.ChallengeID, clientIP),
+		}, nil
+	}
+
+	// Callers answer replays with a conflict rather than an invalid result.
+	if errors.Is(err, argon2.ErrReplay) {
+		return VerifyResponse{}, err
+	}
+
+	if err != nil {
+		return VerifyResponse{
+			Valid:       false,
+			Message:     "Verification failed",
+			RiskScore:   riskScore,
+			BotScore:    riskScore,
+			SupportCode: h.logSupportCode(ctx, "verification_failed", err, req.ChallengeID, clientIP),
+		}, nil
 	}
 
 	response := VerifyResponse{
-		Valid: solution.Valid,
+		Valid:     solution.Valid,
+		RiskScore: riskScore,
+		BotScore:  riskScore,
 	}
 
 	if solution.Valid {
 		response.Message = "Captcha solved successfully"
+
+		if h.webhook != nil {
+			event := webhook.SolveEvent{
+				SolutionID:      solution.ID,
+				ChallengeID:     solution.ChallengeID,
+				ClientIP:        clientIP,
+				UserAgent:       userAgent,
+				FingerprintHash: solution.FingerprintHash,
+				SolvedAt:        solution.CreatedAt,
+			}
+			// Detached from the request so delivery outlives it, but keeps the
+			// request ID for logging.
+			go func() {
+				ctx := context.WithoutCancel(ctx)
+				if err := h.webhook.Send(ctx, event); err != nil {
+					h.logger.ErrorContext(ctx, "Webhook delivery failed", "solution_id", event.SolutionID,
+						"challenge_id", event.ChallengeID, "client_ip", clientIP, "error", err)
+				}
+			}()
+		}
+
+		if h.sealer.Enabled() {
+			sealed, err := h.sealer.Seal(solution.ChallengeID, clientIP, solution.FingerprintHash, solution.CreatedAt)
+			if err != nil {
+				return VerifyResponse{}, fmt.Errorf("Failed to issue sealed token")
+			}
+			response.SealedToken = sealed
+		}
+
+		if h.solutionKey != nil {
+			response.SolutionID = solution.ID
+			response.SolvedAt = solution.CreatedAt.Unix()
+			response.FingerprintHash = solution.FingerprintHash
+			response.SolutionSignature = crypto.SignSolution(h.solutionKey, solution.ChallengeID, solution.ID, clientIP, solution.FingerprintHash, solution.CreatedAt)
+		}
+
+		if h.tokenIssuer != nil {
+			token, err := h.tokenIssuer.Issue(solution, clientIP)
+			if err != nil {
+				return VerifyResponse{}, fmt.Errorf("Failed to issue verify token")
+			}
+			response.Token = token
+		}
 	} else {
 		response.Message = "Invalid solution"
+		response.SupportCode = h.logSupportCode(ctx, "invalid_solution", nil, req.ChallengeID, clientIP)
+	}
+
+	return response, nil
+}
+
+type ExtendChallengeRequest struct {
+	Minutes int `json:"minutes"`
+}
+
+type ExtendChallengeResponse struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	ExpirySignature string `json:"expirySignature,omitempty"`
+}
+
+func (h *Handler) ExtendChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challengeID := mux.Vars(r)["id"]
+
+	req := ExtendChallengeRequest{Minutes: h.cfg.Load().MaxChallengeExtensionMins}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Minutes < 1 || req.Minutes > h.cfg.Load().MaxChallengeExtensionMins {
+		http.Error(w, fmt.Sprintf("Extension must be between 1 and %d minutes", h.cfg.Load().MaxChallengeExtensionMins), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt, err := h.argon2Service.ExtendChallengeExpiry(challengeID, req.Minutes)
+	if err != nil {
+		http.Error(w, "Failed to extend challenge", http.StatusInternalServerError)
+		return
+	}
+
+	if expiresAt == nil {
+		http.Error(w, "Challenge cannot be extended", http.StatusConflict)
+		return
+	}
+
+	response := ExtendChallengeResponse{
+		ID:        challengeID,
+		ExpiresAt: *expiresAt,
+
+		ExpirySignature: h.argon2Service.SignExpiry(challengeID, *expiresAt),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) PublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := map[string]interface{}{
+		"publicKey": base64.StdEncoding.EncodeToString(h.sealer.PublicKey()),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) SolutionPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.solutionKey == nil {
+		http.Error(w, "Solution signing disabled", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"publicKey": base64.StdEncoding.EncodeToString(h.solutionKey.Public().(ed25519.PublicKey)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type TokenVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+type TokenVerifyResponse struct {
+	Valid   bool          `json:"valid"`
+	Message string        `json:"message,omitempty"`
+	Claims  *token.Claims `json:"claims,omitempty"`
+}
+
+func (h *Handler) TokenVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.sealer.Enabled() {
+		http.Error(w, "Sealed tokens are not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req TokenVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var response TokenVerifyResponse
+	claims, err := h.sealer.Open(req.Token)
+	if err != nil {
+		response.Message = err.Error()
+	} else {
+		response.Valid = true
+		response.Claims = claims
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -135,38 +913,109 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	status, dbStatus := "healthy", "ok"
+	if h.db.CircuitOpen() {
+		status, dbStatus = "degraded", "degraded"
+	}
+
+	dbStats := h.db.Stats()
 	response := map[string]interface{}{
-		"status": "healthy",
+		"status": status,
 		"service": "captcha-service",
+		"challengePoolDepth": h.argon2Service.ChallengePoolDepth(),
+		"database": map[string]interface{}{
+			"status":          dbStatus,
+			"openConnections": dbStats.OpenConnections,
+			"inUse":           dbStats.InUse,
+			"waitCount":       dbStats.WaitCount,
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+func (h *Handler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status": "ready",
+	}
+	status := http.StatusOK
+
+	if err := h.db.Ping(); err != nil {
+		h.logger.ErrorContext(r.Context(), "Readiness check: database unreachable", "error", err)
+		response["status"] = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	if h.certChecker != nil {
+		days, err := h.certChecker.DaysUntilExpiry()
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "Readiness check: TLS certificate unreadable", "error", err)
+			response["tls_cert_expiry_warning"] = true
+		} else {
+			response["tls_cert_expires_in_days"] = days
+			response["tls_cert_expiry_warning"] = days < h.cfg.Load().CertExpiryWarningDays
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
 func (h *Handler) getClientIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		ips := strings.Split(forwarded, ",")
-		if len(ips) > 0 {
-			ip := strings.TrimSpace(ips[0])
-			if net.ParseIP(ip) != nil {
+	return GetClientIP(r, h.cfg.Load().TrustedProxyNets)
+}
+
+// GetClientIP returns the direct peer's address unless the peer is a trusted
+// proxy. Forwarded headers from anyone else are ignored, since clients can
+// set them to anything. Behind trusted proxies, X-Forwarded-For is read from
+// the right and the first address that is not itself a trusted proxy wins.
+func GetClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+
+	if !ipTrusted(peer, trustedProxies) {
+		return peer
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if net.ParseIP(ip) == nil {
+				break
+			}
+			if !ipTrusted(ip, trustedProxies) {
 				return ip
 			}
 		}
 	}
 
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		if net.ParseIP(realIP) != nil {
-			return realIP
-		}
+	realIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	if net.ParseIP(realIP) != nil {
+		return realIP
 	}
 
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
+	return peer
+}
 
-	return ip
-} 
\ No newline at end of file
+func ipTrusted(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
\ No newline at end of file
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"strconv"
+	"time"
+)
+
+const (
+	supportCodeLength   = 6
+	supportCodeAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+func (h *Handler) logSupportCode(ctx context.Context, kind string, err error, challengeID, clientIP string) string {
+	code := supportCode(kind, time.Now())
+	h.logger.InfoContext(ctx, "Support code issued", "support_code", code, "kind", kind,
+		"challenge_id", challengeID, "client_ip", clientIP, "error", err)
+	return code
+}
+
+func supportCode(kind string, at time.Time) string {
+	sum := sha256.Sum256([]byte(kind + "|" + strconv.FormatInt(at.UnixNano(), 10)))
+
+	code := make([]byte, supportCodeLength)
+	for i := range code {
+		code[i] = supportCodeAlphabet[int(sum[i])%len(supportCodeAlphabet)]
+	}
+	return string(code)
+}
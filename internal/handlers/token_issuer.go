@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"captcha/internal/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifyTokenClaims identifies the solve a token was issued for; the jti is
+// the solution ID.
+type VerifyTokenClaims struct {
+	ChallengeID string `json:"challengeId"`
+	ClientIP    string `json:"clientIP"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer signs HS256 JWTs for successful verifications, so a
+// downstream service can check a pass with the shared key or through
+// /api/v1/token/validate without touching the database.
+type TokenIssuer struct {
+	key []byte
+	ttl time.Duration
+}
+
+func NewTokenIssuer(key []byte, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{key: key, ttl: ttl}
+}
+
+func (i *TokenIssuer) Issue(solution *database.Solution, clientIP string) (string, error) {
+	claims := VerifyTokenClaims{
+		ChallengeID: solution.ChallengeID,
+		ClientIP:    clientIP,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        solution.ID,
+			IssuedAt:  jwt.NewNumericDate(solution.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(solution.CreatedAt.Add(i.ttl)),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign verify token: %w", err)
+	}
+	return signed, nil
+}
+
+func (i *TokenIssuer) Validate(token string) (*VerifyTokenClaims, error) {
+	claims := &VerifyTokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return i.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+type TokenValidateResponse struct {
+	Valid   bool               `json:"valid"`
+	Message string             `json:"message,omitempty"`
+	Claims  *VerifyTokenClaims `json:"claims,omitempty"`
+}
+
+func (h *Handler) TokenValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.tokenIssuer == nil {
+		http.Error(w, "Verify tokens are not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req TokenVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var response TokenValidateResponse
+	claims, err := h.tokenIssuer.Validate(req.Token)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		response.Message = "token expired"
+	case err != nil:
+		response.Message = "invalid token"
+	default:
+		response.Valid = true
+		response.Claims = claims
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type TokenIntrospectResponse struct {
+	Valid      bool       `json:"valid"`
+	SolutionID string     `json:"solutionId,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// TokenIntrospectHandler is a reduced TokenValidateHandler for services that
+// only need to know whether a token stands for a live solve.
+func (h *Handler) TokenIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.tokenIssuer == nil {
+		http.Error(w, "Verify tokens are not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req TokenVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var response TokenIntrospectResponse
+	if claims, err := h.tokenIssuer.Validate(req.Token); err == nil {
+		response.Valid = true
+		response.SolutionID = claims.ID
+		response.ExpiresAt = &claims.ExpiresAt.Time
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
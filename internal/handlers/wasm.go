@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"captcha/internal/config"
+)
+
+const wasmPath = "./web/fingerprint.wasm"
+
+func wasmFileChecksum() (string, error) {
+	data, err := os.ReadFile(wasmPath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// wasmChecksumCache rehashes the module only when its modification time or
+// size changes, so /params does not read the whole file on every request
+// but still follows a redeploy.
+type wasmChecksumCache struct {
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	checksum string
+}
+
+var cachedWASMChecksum wasmChecksumCache
+
+func (c *wasmChecksumCache) get() (string, error) {
+	info, err := os.Stat(wasmPath)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checksum != "" && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.checksum, nil
+	}
+
+	checksum, err := wasmFileChecksum()
+	if err != nil {
+		return "", err
+	}
+	c.modTime, c.size, c.checksum = info.ModTime(), info.Size(), checksum
+	return checksum, nil
+}
+
+// wasmChecksum is the hash browsers must see before instantiating the WASM
+// module. WASM_EXPECTED_HASH pins it at deploy time so a tampered file on
+// the static server cannot also change the hash the shim compares against.
+func wasmChecksum(cfg *config.Config) (string, error) {
+	if cfg.WASMExpectedHash != "" {
+		return strings.ToLower(cfg.WASMExpectedHash), nil
+	}
+	return cachedWASMChecksum.get()
+}
+
+func (h *Handler) ParamsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	checksum, err := wasmChecksum(h.cfg.Load())
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to hash WASM binary", "error", err)
+		http.Error(w, "WASM binary unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"wasmChecksum": checksum,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type WASMIntegrityResponse struct {
+	Path         string `json:"path"`
+	Checksum     string `json:"checksum"`
+	ExpectedHash string `json:"expectedHash,omitempty"`
+	Match        bool   `json:"match"`
+}
+
+// WASMIntegrityHandler always hashes the file, since tampering need not
+// change its modification time.
+func (h *AdminHandler) WASMIntegrityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	checksum, err := wasmFileChecksum()
+	if err != nil {
+		http.Error(w, "Failed to read WASM binary", http.StatusInternalServerError)
+		return
+	}
+
+	expected := strings.ToLower(h.cfg.Load().WASMExpectedHash)
+	response := WASMIntegrityResponse{
+		Path:         wasmPath,
+		Checksum:     checksum,
+		ExpectedHash: expected,
+		Match:        expected == "" || expected == checksum,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
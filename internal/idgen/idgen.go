@@ -0,0 +1,104 @@
+package idgen
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+
+	"captcha/internal/crypto"
+)
+
+// Generator issues random IDs in one format and recognises IDs it could have
+// issued, so lookups with arbitrary strings can be refused early.
+type Generator interface {
+	New() (string, error)
+	Valid(id string) bool
+}
+
+// ForFormat maps CHALLENGE_ID_FORMAT values to generators.
+func ForFormat(format string) (Generator, error) {
+	switch format {
+	case "hex":
+		return Hex16{}, nil
+	case "uuid":
+		return UUIDv4{}, nil
+	case "base58":
+		return Base58{}, nil
+	default:
+		return nil, fmt.Errorf("unknown ID format %q", format)
+	}
+}
+
+var (
+	hex16Pattern  = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	uuidv4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	base58Pattern = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{22}$`)
+)
+
+// Hex16 is 16 random bytes as 32 lowercase hex characters.
+type Hex16 struct{}
+
+func (Hex16) New() (string, error) {
+	b, err := crypto.GenerateRandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (Hex16) Valid(id string) bool {
+	return hex16Pattern.MatchString(id)
+}
+
+// UUIDv4 is a random RFC 4122 version 4 UUID in lowercase.
+type UUIDv4 struct{}
+
+func (UUIDv4) New() (string, error) {
+	b, err := crypto.GenerateRandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func (UUIDv4) Valid(id string) bool {
+	return uuidv4Pattern.MatchString(id)
+}
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	base58Length   = 22
+)
+
+// Base58 is 16 random bytes in the Bitcoin alphabet, left-padded with '1'
+// to a fixed 22 characters; it avoids characters that are easily confused
+// and needs no escaping in URLs.
+type Base58 struct{}
+
+func (Base58) New() (string, error) {
+	b, err := crypto.GenerateRandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	mod := new(big.Int)
+
+	id := make([]byte, base58Length)
+	for i := range id {
+		id[i] = base58Alphabet[0]
+	}
+	for i := base58Length - 1; n.Sign() > 0; i-- {
+		n.DivMod(n, radix, mod)
+		id[i] = base58Alphabet[mod.Int64()]
+	}
+	return string(id), nil
+}
+
+func (Base58) Valid(id string) bool {
+	return base58Pattern.MatchString(id)
+}
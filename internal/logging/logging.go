@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// NewHandler returns a JSON handler for format "json" and a text handler
+// otherwise, both filtering below level and adding the request ID from the
+// context when there is one.
+func NewHandler(w io.Writer, format, level string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: Level(level)}
+	if format == "json" {
+		return contextHandler{slog.NewJSONHandler(w, opts)}
+	}
+	return contextHandler{slog.NewTextHandler(w, opts)}
+}
+
+// Level maps LOG_LEVEL names to slog levels. Unknown names log at info.
+func Level(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
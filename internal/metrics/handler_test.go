@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, handler http.Handler, authorization string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	body, err := io.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatalf("failed to read scrape body: %v", err)
+	}
+	return rec.Code, string(body)
+}
+
+func TestHandlerExposesMetrics(t *testing.T) {
+	// Vectors only export series once a label value has been used.
+	SolutionsVerifiedTotal.WithLabelValues("valid")
+	FingerprintValidationErrorsTotal.WithLabelValues("userAgent")
+
+	code, body := scrape(t, Handler(""), "")
+	if code != http.StatusOK {
+		t.Fatalf("scrape status = %d, want 200", code)
+	}
+
+	for _, name := range []string{
+		"captcha_challenges_generated_total",
+		"captcha_solutions_verified_total",
+		"captcha_argon2_duration_seconds",
+		"captcha_fingerprint_validation_errors_total",
+		"captcha_rate_limit_hits_total",
+		"captcha_challenge_pool_depth",
+		"captcha_pool_generation_errors_total",
+	} {
+		if !strings.Contains(body, "# TYPE "+name+" ") {
+			t.Errorf("scrape is missing %s", name)
+		}
+	}
+}
+
+func TestHandlerRequiresBearerToken(t *testing.T) {
+	handler := Handler("secret")
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret"} {
+		if code, _ := scrape(t, handler, authorization); code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want 401", authorization, code)
+		}
+	}
+
+	if code, _ := scrape(t, handler, "Bearer secret"); code != http.StatusOK {
+		t.Errorf("valid token: status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ChallengeCorruptionTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "captcha_challenge_corruption_total",
+	Help: "Challenges whose stored Argon2 parameters no longer match their digest.",
+})
+
+var TLSCertExpiryDays = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "captcha_tls_cert_expiry_days",
+	Help: "Whole days until the configured TLS certificate expires.",
+})
+
+var ChallengePoolDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "captcha_challenge_pool_depth",
+	Help: "Pre-generated challenges waiting to be issued.",
+})
+
+var PoolGenerationErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "captcha_pool_generation_errors_total",
+	Help: "Failed attempts to pre-generate a challenge for the pool.",
+})
+
+var ChallengesGeneratedTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "captcha_challenges_generated_total",
+	Help: "Challenges generated, including those pre-generated for the pool.",
+})
+
+var SolutionsVerifiedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "captcha_solutions_verified_total",
+	Help: "Solution submissions by outcome: valid, invalid, expired or replay.",
+}, []string{"result"})
+
+var Argon2DurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "captcha_argon2_duration_seconds",
+	Help:    "Time spent computing a proof-of-work hash during verification.",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+})
+
+var FingerprintValidationErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "captcha_fingerprint_validation_errors_total",
+	Help: "Fingerprint fields that failed validation, by field name.",
+}, []string{"field"})
+
+var RateLimitHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "captcha_rate_limit_hits_total",
+	Help: "Requests rejected by the per-IP rate limiter.",
+})
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"captcha/internal/idgen"
+	"captcha/internal/logging"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	// Matches the request_id columns on challenges and solutions.
+	maxRequestIDLength = 36
+)
+
+// RequestID propagates the caller's X-Request-ID, or a fresh UUIDv4 when it
+// is missing or unusable, through the request context and echoes it back.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID keeps client-supplied IDs short and free of characters that
+// could forge log fields.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id, err := idgen.UUIDv4{}.New()
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate request ID: %v", err))
+	}
+	return id
+}
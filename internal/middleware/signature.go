@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"captcha/pkg/captcha"
+)
+
+const (
+	maxSignatureAge     = 30 * time.Second
+	maxSignedBodyLength = 1 << 20
+)
+
+type signedKey struct{}
+
+// Signed reports whether the request carried a valid signature under
+// REQUEST_SIGNING_KEY, which only integrators' backends hold.
+func Signed(ctx context.Context) bool {
+	signed, _ := ctx.Value(signedKey{}).(bool)
+	return signed
+}
+
+// VerifySignature rejects requests that are not signed with key.
+func VerifySignature(key []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(captcha.SignatureHeader) == "" || r.Header.Get(captcha.TimestampHeader) == "" {
+				http.Error(w, "Missing request signature", http.StatusUnauthorized)
+				return
+			}
+			serveSigned(key, next, w, r)
+		})
+	}
+}
+
+// OptionalSignature passes unsigned requests through, for endpoints browsers
+// call directly, but rejects requests whose signature headers do not check
+// out.
+func OptionalSignature(key []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(captcha.SignatureHeader) == "" && r.Header.Get(captcha.TimestampHeader) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			serveSigned(key, next, w, r)
+		})
+	}
+}
+
+func serveSigned(key []byte, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	signature := r.Header.Get(captcha.SignatureHeader)
+	timestamp := r.Header.Get(captcha.TimestampHeader)
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid request timestamp", http.StatusUnauthorized)
+		return
+	}
+
+	age := time.Since(time.Unix(unix, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		http.Error(w, "Request timestamp expired", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodyLength))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	expected := captcha.Sign(key, r.Method, r.URL.Path, body, timestamp)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), signedKey{}, true)))
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"captcha/pkg/captcha"
+)
+
+func TestOptionalSignature(t *testing.T) {
+	key := []byte("signing-key")
+	const body = `{"challengeId":"abc"}`
+
+	var signed bool
+	handler := OptionalSignature(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed = Signed(r.Context())
+	}))
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	serve := func(signature string) int {
+		signed = false
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/verify", strings.NewReader(body))
+		if signature != "" {
+			req.Header.Set(captcha.TimestampHeader, timestamp)
+			req.Header.Set(captcha.SignatureHeader, signature)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(""); code != http.StatusOK || signed {
+		t.Fatalf("unsigned request: status %d, signed %v; want 200, false", code, signed)
+	}
+
+	valid := captcha.Sign(key, http.MethodPost, "/api/v1/verify", []byte(body), timestamp)
+	if code := serve(valid); code != http.StatusOK || !signed {
+		t.Fatalf("signed request: status %d, signed %v; want 200, true", code, signed)
+	}
+
+	forged := captcha.Sign([]byte("other-key"), http.MethodPost, "/api/v1/verify", []byte(body), timestamp)
+	if code := serve(forged); code != http.StatusUnauthorized || signed {
+		t.Fatalf("forged signature: status %d, signed %v; want 401, false", code, signed)
+	}
+}
@@ -0,0 +1,108 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	CamelCase = "camelCase"
+	SnakeCase = "snake_case"
+)
+
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func Encoder(responseCase string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if responseCase != SnakeCase {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			buffered := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(buffered, r)
+
+			body := buffered.body.Bytes()
+			if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") && len(body) > 0 {
+				if converted, err := convertKeys(body); err == nil {
+					body = converted
+					w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				}
+			}
+
+			w.WriteHeader(buffered.status)
+			w.Write(body)
+		})
+	}
+}
+
+func convertKeys(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	converted, err := json.Marshal(snakeKeys(value))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(converted, '\n'), nil
+}
+
+func snakeKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[ToSnakeCase(key)] = snakeKeys(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = snakeKeys(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func ToSnakeCase(key string) string {
+	runes := []rune(key)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			acronymEnd := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || acronymEnd {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package scrypt
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"captcha/internal/config"
+	"captcha/internal/database"
+	"golang.org/x/crypto/scrypt"
+)
+
+const Algorithm = "scrypt"
+
+// Upper bounds accepted on stored challenges. They are far above any sane
+// configuration and only guard against a tampered row making verification
+// allocate unbounded memory.
+const (
+	maxAllowedN = 1 << 20
+	maxAllowedR = 32
+	maxAllowedP = 16
+)
+
+// Service computes scrypt proof-of-work hashes. Challenges reuse the Argon2
+// parameter columns: difficulty holds N, memory holds r and threads holds p.
+type Service struct {
+	cfg *atomic.Pointer[config.Config]
+}
+
+func NewService(cfg *atomic.Pointer[config.Config]) *Service {
+	return &Service{cfg: cfg}
+}
+
+func (s *Service) Name() string {
+	return Algorithm
+}
+
+func (s *Service) ApplyParams(challenge *database.Challenge) {
+	challenge.Difficulty = s.cfg.Load().ScryptN
+	challenge.Memory = s.cfg.Load().ScryptR
+	challenge.Threads = s.cfg.Load().ScryptP
+	challenge.KeyLen = s.cfg.Load().ScryptKeyLength
+}
+
+func (s *Service) Hash(challenge *database.Challenge, salt []byte, nonce string) (string, error) {
+	hash, err := scrypt.Key(
+		[]byte(challenge.Salt+nonce),
+		salt,
+		int(challenge.Difficulty),
+		int(challenge.Memory),
+		int(challenge.Threads),
+		int(challenge.KeyLen),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute scrypt hash: %w", err)
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+func (s *Service) ParamsInAllowedRange(challenge *database.Challenge) bool {
+	n := challenge.Difficulty
+	return n > 1 && n&(n-1) == 0 && n <= maxAllowedN &&
+		challenge.Memory >= 1 && challenge.Memory <= maxAllowedR &&
+		challenge.Threads >= 1 && challenge.Threads <= maxAllowedP
+}
+
+// EstimateSolveTime uses SCRYPT_CLIENT_HASH_RATE, the rate of the WASM
+// solver in a browser, and the challenge's own target.
+func (s *Service) EstimateSolveTime(challenge *database.Challenge) time.Duration {
+	estimatedAttempts := math.Pow(16, float64(len(challenge.Target)))
+	estimate := time.Duration(estimatedAttempts / s.cfg.Load().ScryptClientHashRate * float64(time.Second))
+
+	maxEstimate := time.Duration(s.cfg.Load().Argon2MaxSolveTime) * time.Second
+	if estimate > maxEstimate {
+		estimate = maxEstimate
+	}
+
+	return estimate
+}
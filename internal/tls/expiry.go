@@ -0,0 +1,45 @@
+package tls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"captcha/internal/metrics"
+)
+
+type CertExpiryChecker struct {
+	certFile string
+}
+
+func NewCertExpiryChecker(certFile string) *CertExpiryChecker {
+	return &CertExpiryChecker{certFile: certFile}
+}
+
+// DaysUntilExpiry reads the certificate file on every call so a renewed
+// certificate is picked up without a restart. Only the leaf (first) PEM
+// block is checked. The result is also published as a gauge.
+func (c *CertExpiryChecker) DaysUntilExpiry() (int, error) {
+	data, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return 0, errors.New("no PEM certificate found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	days := int(time.Until(cert.NotAfter) / (24 * time.Hour))
+	metrics.TLSCertExpiryDays.Set(float64(days))
+
+	return days, nil
+}
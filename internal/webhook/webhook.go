@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"captcha/internal/config"
+)
+
+const (
+	maxRetries      = 3
+	initialBackoff  = time.Second
+	signatureHeader = "X-Captcha-Signature"
+)
+
+// SolveEvent is the JSON body posted for every valid solution.
+type SolveEvent struct {
+	SolutionID      string    `json:"solutionId"`
+	ChallengeID     string    `json:"challengeId"`
+	ClientIP        string    `json:"clientIP"`
+	UserAgent       string    `json:"userAgent"`
+	FingerprintHash string    `json:"fingerprintHash"`
+	SolvedAt        time.Time `json:"solvedAt"`
+}
+
+// Dispatcher posts solve events to WEBHOOK_URL, signed with WEBHOOK_SECRET.
+type Dispatcher struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewDispatcher returns nil when WEBHOOK_URL is not set.
+func NewDispatcher(cfg *config.Config) *Dispatcher {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+	return &Dispatcher{
+		url:    cfg.WebhookURL,
+		secret: []byte(cfg.WebhookSecret),
+		client: &http.Client{Timeout: time.Duration(cfg.WebhookTimeoutSecs) * time.Second},
+	}
+}
+
+// Send delivers event, retrying up to three times with doubling backoff on
+// network errors, 429 and 5xx responses. Other responses are final.
+func (d *Dispatcher) Send(ctx context.Context, event SolveEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+	signature := Sign(body, d.secret)
+
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := d.post(ctx, body, signature)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == maxRetries {
+			return err
+		}
+
+		slog.WarnContext(ctx, "Webhook delivery failed, retrying", "solution_id", event.SolutionID,
+			"attempt", attempt+1, "backoff_ms", backoff.Milliseconds(), "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, body []byte, signature string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(signatureHeader, signature)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of body that receivers recompute to
+// authenticate a delivery.
+func Sign(body, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,76 @@
+package captchamw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"captcha/pkg/captcha"
+	"captcha/pkg/token"
+)
+
+type contextKey struct{}
+
+// TokenVerifier is satisfied by *captcha.Client, which asks the captcha
+// server, and by *token.LocalVerifier, which opens tokens in process.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (*token.Claims, error)
+}
+
+var (
+	_ TokenVerifier = (*captcha.Client)(nil)
+	_ TokenVerifier = (*token.LocalVerifier)(nil)
+)
+
+// Require rejects requests without a valid solve token with 403 and stores
+// the token's claims in the request context for the next handler.
+func Require(client TokenVerifier, tokenExtractor func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sealedToken := tokenExtractor(r)
+			if sealedToken == "" {
+				http.Error(w, "Captcha token required", http.StatusForbidden)
+				return
+			}
+
+			claims, err := client.VerifyToken(r.Context(), sealedToken)
+			if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenExpired) {
+				http.Error(w, "Invalid captcha token", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Captcha verification unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims)))
+		})
+	}
+}
+
+func ClaimsFromContext(ctx context.Context) (*token.Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*token.Claims)
+	return claims, ok
+}
+
+func FromHeader(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+func FromCookie(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+func FromFormValue(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.FormValue(name)
+	}
+}
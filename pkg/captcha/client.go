@@ -0,0 +1,187 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"captcha/internal/crypto"
+	"captcha/pkg/token"
+)
+
+const (
+	SignatureHeader = "X-Captcha-Signature"
+	TimestampHeader = "X-Captcha-Timestamp"
+
+	// ClientHeader names the SDK a request came from. The server does not
+	// trust it: only a request signature (see SetRequestSigning) or an
+	// address in BACKEND_CIDRS exempts a backend from honeypot blocking.
+	ClientHeader = "X-Captcha-Client"
+)
+
+type VerifyRequest struct {
+	ChallengeID string `json:"challengeId"`
+	Nonce       string `json:"nonce"`
+	Hash        string `json:"hash"`
+	Fingerprint string `json:"fingerprint"`
+
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type VerifyResponse struct {
+	Valid       bool    `json:"valid"`
+	Message     string  `json:"message,omitempty"`
+	RiskScore   float64 `json:"riskScore"`
+	BotScore    float64 `json:"botScore"`
+	SealedToken string  `json:"sealedToken,omitempty"`
+
+	SolutionID        string `json:"solutionId,omitempty"`
+	SolvedAt          int64  `json:"solvedAt,omitempty"`
+	FingerprintHash   string `json:"fingerprintHash,omitempty"`
+	SolutionSignature string `json:"solutionSignature,omitempty"`
+
+	Token string `json:"token,omitempty"`
+}
+
+// VerifySignature checks SolutionSignature against the key served at
+// /api/v1/ed25519-pubkey. clientIP is the address the application saw, so a
+// response relayed from another client fails.
+func (r *VerifyResponse) VerifySignature(publicKey []byte, challengeID, clientIP string) bool {
+	if r.SolutionSignature == "" {
+		return false
+	}
+	return crypto.VerifySolutionSignature(publicKey, r.SolutionSignature, challengeID, r.SolutionID, clientIP, r.FingerprintHash, time.Unix(r.SolvedAt, 0))
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	signingKey []byte
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+// SetRequestSigning enables HMAC-SHA256 signing of every request with key,
+// the server's REQUEST_SIGNING_KEY. The server requires it on batch
+// verification and checks it on single and token verification. A nil or
+// empty key disables signing.
+func (c *Client) SetRequestSigning(key []byte) {
+	c.signingKey = key
+}
+
+func (c *Client) Verify(ctx context.Context, req VerifyRequest) (*VerifyResponse, error) {
+	var resp VerifyResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/verify", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) VerifyBatch(ctx context.Context, reqs []VerifyRequest) ([]VerifyResponse, error) {
+	body := struct {
+		Requests []VerifyRequest `json:"requests"`
+	}{Requests: reqs}
+
+	var resp struct {
+		Results []VerifyResponse `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/verify/batch", body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+type tokenVerifyResponse struct {
+	Valid   bool          `json:"valid"`
+	Message string        `json:"message"`
+	Claims  *token.Claims `json:"claims"`
+}
+
+func (c *Client) VerifyToken(ctx context.Context, sealedToken string) (*token.Claims, error) {
+	body := struct {
+		Token string `json:"token"`
+	}{Token: sealedToken}
+
+	var resp tokenVerifyResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/token/verify", body, &resp); err != nil {
+		return nil, err
+	}
+
+	if !resp.Valid || resp.Claims == nil {
+		if resp.Message == token.ErrTokenExpired.Error() {
+			return nil, token.ErrTokenExpired
+		}
+		return nil, token.ErrInvalidToken
+	}
+
+	return resp.Claims, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ClientHeader, "go")
+
+	if len(c.signingKey) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(c.signingKey, method, req.URL.Path, body, timestamp))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of
+// method + "\n" + path + "\n" + hex(sha256(body)) + "\n" + timestamp.
+func Sign(key []byte, method, path string, body []byte, timestamp string) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + path + "\n" + hex.EncodeToString(bodyHash[:]) + "\n" + timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,186 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const KeySize = 32
+
+var (
+	ErrInvalidToken = errors.New("invalid sealed token")
+	ErrTokenExpired = errors.New("sealed token expired")
+)
+
+type Claims struct {
+	ChallengeID     string `json:"challenge_id"`
+	SolveTime       int64  `json:"solve_time"`
+	ClientIP        string `json:"client_ip"`
+	FingerprintHash string `json:"fingerprint_hash"`
+	Exp             int64  `json:"exp"`
+}
+
+type Sealer struct {
+	privateKey         [KeySize]byte
+	publicKey          [KeySize]byte
+	recipientPublicKey *[KeySize]byte
+	ttl                time.Duration
+}
+
+func NewSealer(privateKey, recipientPublicKey []byte, ttl time.Duration) (*Sealer, error) {
+	if len(privateKey) != KeySize {
+		return nil, fmt.Errorf("private key must be %d bytes, got %d", KeySize, len(privateKey))
+	}
+
+	publicKey, err := PublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sealer{ttl: ttl}
+	copy(s.privateKey[:], privateKey)
+	copy(s.publicKey[:], publicKey)
+
+	if len(recipientPublicKey) > 0 {
+		if len(recipientPublicKey) != KeySize {
+			return nil, fmt.Errorf("recipient public key must be %d bytes, got %d", KeySize, len(recipientPublicKey))
+		}
+		s.recipientPublicKey = new([KeySize]byte)
+		copy(s.recipientPublicKey[:], recipientPublicKey)
+	}
+
+	return s, nil
+}
+
+func GenerateKey() ([]byte, error) {
+	_, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return privateKey[:], nil
+}
+
+func PublicKey(privateKey []byte) ([]byte, error) {
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive public key: %w", err)
+	}
+	return publicKey, nil
+}
+
+func (s *Sealer) PublicKey() []byte {
+	return s.publicKey[:]
+}
+
+func (s *Sealer) Enabled() bool {
+	return s.recipientPublicKey != nil
+}
+
+func (s *Sealer) Seal(challengeID, clientIP, fingerprintHash string, solvedAt time.Time) (string, error) {
+	if !s.Enabled() {
+		return "", fmt.Errorf("no recipient public key configured")
+	}
+
+	claims := Claims{
+		ChallengeID:     challengeID,
+		SolveTime:       solvedAt.Unix(),
+		ClientIP:        clientIP,
+		FingerprintHash: fingerprintHash,
+		Exp:             solvedAt.Add(s.ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize claims: %w", err)
+	}
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := box.Seal(nonce[:], payload, &nonce, s.recipientPublicKey, &s.privateKey)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecodeSealed opens a token issued by the captcha server. pubKey is the
+// server's public key from GET /api/v1/pubkey and recipientPrivateKey is the
+// private half of the key the server was configured to seal tokens for.
+func DecodeSealed(token string, pubKey, recipientPrivateKey []byte) (*Claims, error) {
+	if len(pubKey) != KeySize || len(recipientPrivateKey) != KeySize {
+		return nil, fmt.Errorf("keys must be %d bytes", KeySize)
+	}
+
+	var senderKey, privateKey [KeySize]byte
+	copy(senderKey[:], pubKey)
+	copy(privateKey[:], recipientPrivateKey)
+
+	return open(token, &senderKey, &privateKey)
+}
+
+// LocalVerifier opens sealed tokens in process, so a downstream service can
+// check them without calling the captcha server.
+type LocalVerifier struct {
+	serverPublicKey     []byte
+	recipientPrivateKey []byte
+}
+
+func NewLocalVerifier(serverPublicKey, recipientPrivateKey []byte) (*LocalVerifier, error) {
+	if len(serverPublicKey) != KeySize || len(recipientPrivateKey) != KeySize {
+		return nil, fmt.Errorf("keys must be %d bytes", KeySize)
+	}
+
+	return &LocalVerifier{
+		serverPublicKey:     serverPublicKey,
+		recipientPrivateKey: recipientPrivateKey,
+	}, nil
+}
+
+func (v *LocalVerifier) VerifyToken(ctx context.Context, token string) (*Claims, error) {
+	return DecodeSealed(token, v.serverPublicKey, v.recipientPrivateKey)
+}
+
+// Open checks a token issued by this sealer. The box key shared with the
+// recipient is symmetric, so the server can open what it sealed.
+func (s *Sealer) Open(token string) (*Claims, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("no recipient public key configured")
+	}
+
+	return open(token, s.recipientPublicKey, &s.privateKey)
+}
+
+func open(token string, peersPublicKey, privateKey *[KeySize]byte) (*Claims, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(sealed) < 24+box.Overhead {
+		return nil, ErrInvalidToken
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed[:24])
+
+	payload, ok := box.Open(nil, sealed[24:], &nonce, peersPublicKey, privateKey)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() > claims.Exp {
+		return nil, ErrTokenExpired
+	}
+
+	return &claims, nil
+}
@@ -4,11 +4,22 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
+	"embed"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall/js"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
 )
 
 type FingerprintData struct {
@@ -24,8 +35,50 @@ type FingerprintData struct {
 	DoNotTrack                  string  `json:"doNotTrack"`
 	ScreenResolution            string  `json:"screenResolution"`
 	AvailableScreenResolution   string  `json:"availableScreenResolution"`
+	ShadowDOMDepth              int     `json:"shadowDOMDepth"`
+	CustomElementCount          int     `json:"customElementCount"`
+	TimerGranularityUs          float64 `json:"timerGranularityUs"`
+	ScreenOrientation           string  `json:"screenOrientation"`
+	ScreenOrientationType       string  `json:"screenOrientationType"`
+	WASMInstantiationTimeMs     int     `json:"wasmInstantiationTimeMs"`
+	GPUMaxTextureSize           *int    `json:"gpuMaxTextureSize"`
+	PointerLockAvailable        bool    `json:"pointerLockAvailable"`
+	FullscreenAvailable         bool    `json:"fullscreenAvailable"`
+	IdleCallbackLatencyMs       *int    `json:"idleCallbackLatencyMs"`
+	MediaQueryFingerprint       string  `json:"mediaQueryFingerprint"`
+	BroadcastChannelAvailable   bool    `json:"broadcastChannelAvailable"`
+	CrossTabCommunicationActive bool    `json:"crossTabCommunicationActive"`
+	FingerprintResistanceDetected bool  `json:"fingerprintResistanceDetected"`
+	CSSAnimationTimingPrecisionUs *int  `json:"cssAnimationTimingPrecisionUs"`
+	StorageQuotaGB              *float64 `json:"storageQuotaGB"`
+	StorageUsageMB              *float64 `json:"storageUsageMB"`
+	SpeechVoiceCount            int     `json:"speechVoiceCount"`
+	SpeechVoiceHash             string  `json:"speechVoiceHash"`
+	ServiceWorkerAvailable      bool    `json:"serviceWorkerAvailable"`
+	ServiceWorkerRegistered     bool    `json:"serviceWorkerRegistered"`
+	GPUTier                     string  `json:"gpuTier"`
+	PageAgeSeconds              int     `json:"pageAgeSeconds"`
+	SupportedMIMEHash           string  `json:"supportedMIMEHash"`
+	CacheAPIAvailable           bool    `json:"cacheAPIAvailable"`
+	EstimatedCacheLatencyMs     *int    `json:"estimatedCacheLatencyMs"`
+	CSSCustomPropertiesSupported bool   `json:"cssCustomPropertiesSupported"`
+	CSSGridSupported            bool    `json:"cssGridSupported"`
+	CSSFlexSupported            bool    `json:"cssFlexSupported"`
+	ClipboardContentHash        *string `json:"clipboardContentHash"`
+	CanvasHash                  string  `json:"canvasHash"`
+	WebGLRenderer               string  `json:"webglRenderer"`
+	WebGLVendor                 string  `json:"webglVendor"`
+	WebGLExtensionCount         int     `json:"webglExtensionCount"`
+	WebDriver                   bool     `json:"webDriver"`
+	Languages                   []string `json:"languages"`
+	PluginCount                 int      `json:"pluginCount"`
+	RTCLocalIPHash              string   `json:"rtcLocalIPHash"`
 }
 
+// aesKeyVersion must match AES_ACTIVE_KEY_VERSION on the server, and
+// aesKey the AES_KEY_v<n> it names.
+const aesKeyVersion byte = 1
+
 var aesKey = []byte{
 	0x36, 0x37, 0xe1, 0x93, 0x89, 0x36, 0xac, 0xc4,
 	0x39, 0xf7, 0x4d, 0xec, 0x3d, 0x13, 0xee, 0x3f,
@@ -33,17 +86,443 @@ var aesKey = []byte{
 	0x73, 0x3d, 0x97, 0x30, 0xc3, 0x24, 0xbe, 0x33,
 }
 
+//go:embed gpu_tiers.json
+var gpuTierFS embed.FS
+
+type gpuTierRule struct {
+	Pattern string `json:"pattern"`
+	Tier    string `json:"tier"`
+}
+
+var idleCallbackLatencyMs *int
+
+var cssAnimationTimingPrecisionUs *int
+
+var (
+	storageQuotaGB *float64
+	storageUsageMB *float64
+)
+
+var serviceWorkerRegistered bool
+
+var (
+	cacheAPIAvailable       bool
+	estimatedCacheLatencyMs *int
+)
+
+var clipboardContentHash *string
+
+// rtcLocalIPHash stays empty until ICE gathering completes.
+var rtcLocalIPHash string
+
+const clipboardHashChars = 1024
+
+const (
+	cacheProbeName  = "_wg2_cache_probe"
+	cacheProbeURL   = "/_wg2_cache_probe"
+	cacheProbeBytes = 1 << 20
+)
+
+const cssAnimationSamples = 5
+
+var (
+	broadcastChannelAvailable   bool
+	crossTabCommunicationActive bool
+)
+
+var mimeTypes = []string{
+	`video/mp4; codecs="avc1.42E01E"`,
+	`video/mp4; codecs="avc1.4D401E"`,
+	`video/mp4; codecs="avc1.64001E"`,
+	`video/mp4; codecs="avc1.640028"`,
+	`video/mp4; codecs="avc1.640033"`,
+	`video/mp4; codecs="hev1.1.6.L93.B0"`,
+	`video/mp4; codecs="hvc1.1.6.L93.B0"`,
+	`video/mp4; codecs="vp09.00.10.08"`,
+	`video/mp4; codecs="av01.0.05M.08"`,
+	`video/mp4; codecs="av01.0.08M.10"`,
+	`video/webm; codecs="vp8"`,
+	`video/webm; codecs="vp8, vorbis"`,
+	`video/webm; codecs="vp9"`,
+	`video/webm; codecs="vp09.00.10.08"`,
+	`video/webm; codecs="vp09.02.10.10"`,
+	`video/webm; codecs="av01.0.05M.08"`,
+	`video/webm; codecs="vp9, opus"`,
+	`audio/mp4; codecs="mp4a.40.2"`,
+	`audio/mp4; codecs="mp4a.40.5"`,
+	`audio/mp4; codecs="mp4a.40.29"`,
+	`audio/mp4; codecs="mp4a.69"`,
+	`audio/mp4; codecs="opus"`,
+	`audio/mp4; codecs="flac"`,
+	`audio/mp4; codecs="ec-3"`,
+	`audio/mp4; codecs="ac-3"`,
+	`audio/webm; codecs="opus"`,
+	`audio/webm; codecs="vorbis"`,
+	`audio/mpeg`,
+	`audio/aac`,
+	`audio/flac`,
+}
+
+var mediaQueries = []string{
+	"(hover: hover)",
+	"(any-hover: hover)",
+	"(pointer: fine)",
+	"(pointer: coarse)",
+	"(any-pointer: fine)",
+	"(any-pointer: coarse)",
+	"(display-mode: standalone)",
+	"(display-mode: fullscreen)",
+	"(prefers-reduced-motion: reduce)",
+	"(prefers-color-scheme: dark)",
+	"(prefers-contrast: more)",
+	"(prefers-reduced-transparency: reduce)",
+	"(forced-colors: active)",
+	"(inverted-colors: inverted)",
+	"(color-gamut: srgb)",
+	"(color-gamut: p3)",
+	"(color-gamut: rec2020)",
+	"(dynamic-range: high)",
+	"(orientation: portrait)",
+	"(scripting: enabled)",
+}
+
 func main() {
 	c := make(chan struct{}, 0)
 
+	measureIdleCallbackLatency()
+	measureCSSAnimationTiming()
+	measureStorageEstimate()
+	loadSpeechVoices()
+	checkServiceWorkerRegistrations()
+	measureCacheLatency()
+	hashClipboardContent()
+	startBroadcastProbe()
+	gatherRTCCandidates()
+
 	js.Global().Set("collectFingerprint", js.FuncOf(collectFingerprint))
 	js.Global().Set("encryptData", js.FuncOf(encryptData))
+	js.Global().Set("solveArgon2", js.FuncOf(solveArgon2JS))
 
 	<-c
 }
 
 
 
+func measureIdleCallbackLatency() {
+	requestIdleCallback := js.Global().Get("requestIdleCallback")
+	if requestIdleCallback.Type() != js.TypeFunction {
+		return
+	}
+
+	performance := js.Global().Get("performance")
+	start := performance.Call("now").Float()
+
+	var callback js.Func
+	callback = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		latency := int(math.Round(performance.Call("now").Float() - start))
+		idleCallbackLatencyMs = &latency
+		callback.Release()
+		return nil
+	})
+
+	js.Global().Call("requestIdleCallback", callback, map[string]interface{}{"timeout": 1000})
+}
+
+func measureCSSAnimationTiming() {
+	document := js.Global().Get("document")
+	body := document.Get("body")
+	if body.IsNull() || body.IsUndefined() {
+		return
+	}
+
+	style := document.Call("createElement", "style")
+	style.Set("textContent", "@keyframes _wg2_tick{from{opacity:1}to{opacity:.99}}")
+	document.Get("head").Call("appendChild", style)
+
+	element := document.Call("createElement", "div")
+	element.Get("style").Set("cssText", "position:absolute;left:-9999px;width:1px;height:1px;animation:_wg2_tick 20ms linear infinite")
+	body.Call("appendChild", element)
+
+	performance := js.Global().Get("performance")
+	var timestamps []float64
+
+	var listener js.Func
+	listener = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		timestamps = append(timestamps, performance.Call("now").Float())
+		if len(timestamps) <= cssAnimationSamples {
+			return nil
+		}
+
+		element.Call("removeEventListener", "animationiteration", listener)
+		element.Call("remove")
+		style.Call("remove")
+		listener.Release()
+
+		gaps := make([]float64, 0, cssAnimationSamples)
+		for i := 1; i < len(timestamps); i++ {
+			gaps = append(gaps, timestamps[i]-timestamps[i-1])
+		}
+
+		precision := -1.0
+		for i := range gaps {
+			for j := i + 1; j < len(gaps); j++ {
+				if diff := math.Abs(gaps[i] - gaps[j]); diff > 0 && (precision < 0 || diff < precision) {
+					precision = diff
+				}
+			}
+		}
+
+		us := 0
+		if precision > 0 {
+			us = int(math.Round(precision * 1000))
+		}
+		cssAnimationTimingPrecisionUs = &us
+		return nil
+	})
+
+	element.Call("addEventListener", "animationiteration", listener)
+}
+
+func measureStorageEstimate() {
+	storage := js.Global().Get("navigator").Get("storage")
+	if storage.IsUndefined() || storage.Get("estimate").Type() != js.TypeFunction {
+		return
+	}
+
+	var onEstimate js.Func
+	onEstimate = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		defer onEstimate.Release()
+
+		estimate := args[0]
+		if estimate.Get("quota").Type() != js.TypeNumber || estimate.Get("usage").Type() != js.TypeNumber {
+			return nil
+		}
+
+		quota := estimate.Get("quota").Float() / (1 << 30)
+		usage := estimate.Get("usage").Float() / (1 << 20)
+		storageQuotaGB = &quota
+		storageUsageMB = &usage
+		return nil
+	})
+
+	storage.Call("estimate").Call("then", onEstimate)
+}
+
+func loadSpeechVoices() {
+	speechSynthesis := js.Global().Get("speechSynthesis")
+	if speechSynthesis.IsUndefined() || speechSynthesis.Get("getVoices").Type() != js.TypeFunction {
+		return
+	}
+
+	// Chrome loads voices asynchronously and only starts once getVoices is
+	// first called, so warm the list up before collectFingerprint reads it.
+	speechSynthesis.Call("getVoices")
+}
+
+func checkServiceWorkerRegistrations() {
+	serviceWorker := js.Global().Get("navigator").Get("serviceWorker")
+	if serviceWorker.IsUndefined() || serviceWorker.Get("getRegistrations").Type() != js.TypeFunction {
+		return
+	}
+
+	var onRegistrations js.Func
+	onRegistrations = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		defer onRegistrations.Release()
+		serviceWorkerRegistered = args[0].Length() > 0
+		return nil
+	})
+
+	serviceWorker.Call("getRegistrations").Call("then", onRegistrations)
+}
+
+// measureCacheLatency round-trips a 1 MiB body through the Cache API. Some
+// private modes reject caches.open or back the cache with memory, which
+// shows up as an error or an unusually fast read.
+func measureCacheLatency() {
+	caches := js.Global().Get("caches")
+	if caches.IsUndefined() || caches.Get("open").Type() != js.TypeFunction {
+		return
+	}
+
+	var onOpen, onPut, onMatch, onRead, onError js.Func
+	var start float64
+	release := func() {
+		onOpen.Release()
+		onPut.Release()
+		onMatch.Release()
+		onRead.Release()
+		onError.Release()
+		caches.Call("delete", cacheProbeName)
+	}
+
+	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		return nil
+	})
+
+	var cache js.Value
+	onOpen = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		cacheAPIAvailable = true
+		cache = args[0]
+		body := js.Global().Get("ArrayBuffer").New(cacheProbeBytes)
+		response := js.Global().Get("Response").New(body)
+		cache.Call("put", cacheProbeURL, response).Call("then", onPut).Call("catch", onError)
+		return nil
+	})
+
+	onPut = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		start = js.Global().Get("performance").Call("now").Float()
+		cache.Call("match", cacheProbeURL).Call("then", onMatch).Call("catch", onError)
+		return nil
+	})
+
+	onMatch = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if args[0].IsUndefined() {
+			release()
+			return nil
+		}
+		args[0].Call("arrayBuffer").Call("then", onRead).Call("catch", onError)
+		return nil
+	})
+
+	onRead = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		latency := int(js.Global().Get("performance").Call("now").Float() - start)
+		estimatedCacheLatencyMs = &latency
+		release()
+		return nil
+	})
+
+	caches.Call("open", cacheProbeName).Call("then", onOpen).Call("catch", onError)
+}
+
+// hashClipboardContent only reads the clipboard when clipboard-read is
+// already granted; querying the permission never prompts, and browsers
+// without the permission name reject the query.
+func hashClipboardContent() {
+	navigator := js.Global().Get("navigator")
+	permissions := navigator.Get("permissions")
+	clipboard := navigator.Get("clipboard")
+	if permissions.IsUndefined() || permissions.Get("query").Type() != js.TypeFunction ||
+		clipboard.IsUndefined() || clipboard.Get("readText").Type() != js.TypeFunction {
+		return
+	}
+
+	var onPermission, onText, onError js.Func
+	release := func() {
+		onPermission.Release()
+		onText.Release()
+		onError.Release()
+	}
+
+	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		return nil
+	})
+
+	onPermission = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if args[0].Get("state").String() != "granted" {
+			release()
+			return nil
+		}
+		clipboard.Call("readText").Call("then", onText).Call("catch", onError)
+		return nil
+	})
+
+	onText = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		text := args[0].Call("slice", 0, clipboardHashChars).String()
+		sum := sha256.Sum256([]byte(text))
+		hash := hex.EncodeToString(sum[:])
+		clipboardContentHash = &hash
+		release()
+		return nil
+	})
+
+	query := js.Global().Get("Object").New()
+	query.Set("name", "clipboard-read")
+	permissions.Call("query", query).Call("then", onPermission).Call("catch", onError)
+}
+
+// gatherRTCCandidates opens a peer connection with no ICE servers, so only
+// host candidates are gathered, and hashes their sorted addresses once
+// gathering finishes. Browsers that hide local IPs behind mDNS hostnames
+// still yield a stable hash for the session.
+func gatherRTCCandidates() {
+	peerConnection := js.Global().Get("RTCPeerConnection")
+	if peerConnection.Type() != js.TypeFunction {
+		rtcLocalIPHash = "unsupported"
+		return
+	}
+
+	pc := peerConnection.New(map[string]interface{}{"iceServers": []interface{}{}})
+	pc.Call("createDataChannel", "")
+
+	addresses := map[string]bool{}
+	var onCandidate, onOffer, onError js.Func
+	release := func() {
+		pc.Set("onicecandidate", js.Null())
+		pc.Call("close")
+		onCandidate.Release()
+		onOffer.Release()
+		onError.Release()
+	}
+
+	onError = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rtcLocalIPHash = "unsupported"
+		release()
+		return nil
+	})
+
+	onCandidate = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		candidate := args[0].Get("candidate")
+		if candidate.IsNull() || candidate.IsUndefined() {
+			entries := make([]string, 0, len(addresses))
+			for address := range addresses {
+				entries = append(entries, address)
+			}
+			sort.Strings(entries)
+
+			hash := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+			rtcLocalIPHash = hex.EncodeToString(hash[:])
+			release()
+			return nil
+		}
+
+		// candidate:<foundation> <component> <protocol> <priority> <address> <port> typ <type> ...
+		fields := strings.Fields(candidate.Get("candidate").String())
+		if len(fields) >= 8 && fields[7] == "host" {
+			addresses[fields[4]] = true
+		}
+		return nil
+	})
+
+	onOffer = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return pc.Call("setLocalDescription", args[0])
+	})
+
+	pc.Set("onicecandidate", onCandidate)
+	pc.Call("createOffer").Call("then", onOffer).Call("catch", onError)
+}
+
+func startBroadcastProbe() {
+	broadcastChannel := js.Global().Get("BroadcastChannel")
+	if broadcastChannel.Type() != js.TypeFunction {
+		return
+	}
+
+	channel := broadcastChannel.New("_wg2_probe")
+	broadcastChannelAvailable = true
+
+	channel.Set("onmessage", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		crossTabCommunicationActive = true
+		if len(args) > 0 && args[0].Get("data").String() == "probe" {
+			channel.Call("postMessage", "ack")
+		}
+		return nil
+	}))
+
+	channel.Call("postMessage", "probe")
+}
+
 func collectFingerprint(this js.Value, args []js.Value) interface{} {
 
 	window := js.Global().Get("window")
@@ -61,6 +540,10 @@ func collectFingerprint(this js.Value, args []js.Value) interface{} {
 		CookieEnabled:       navigator.Get("cookieEnabled").Bool(),
 	}
 
+	if len(args) > 0 && args[0].Type() == js.TypeNumber {
+		fingerprint.WASMInstantiationTimeMs = int(math.Round(args[0].Float()))
+	}
+
 	date := js.Global().Get("Date").New()
 	timezoneOffset := date.Call("getTimezoneOffset").Int()
 	fingerprint.Timezone = fmt.Sprintf("%d", timezoneOffset)
@@ -80,6 +563,43 @@ func collectFingerprint(this js.Value, args []js.Value) interface{} {
 		screen.Get("availWidth").Int(), 
 		screen.Get("availHeight").Int())
 
+	fingerprint.ScreenOrientation, fingerprint.ScreenOrientationType = screenOrientation(screen)
+
+	document := js.Global().Get("document")
+	fingerprint.ShadowDOMDepth = shadowDOMDepth(document, 0)
+	fingerprint.CustomElementCount = customElementCount(document)
+	fingerprint.TimerGranularityUs = timerGranularityUs()
+	fingerprint.GPUMaxTextureSize = gpuMaxTextureSize(document)
+	fingerprint.GPUTier = gpuTier(document)
+	fingerprint.PageAgeSeconds = pageAgeSeconds()
+	fingerprint.SupportedMIMEHash = supportedMIMEHash(window)
+	fingerprint.PointerLockAvailable = !document.Get("pointerLockElement").IsUndefined() &&
+		!document.Get("documentElement").Get("requestPointerLock").IsUndefined()
+	fingerprint.FullscreenAvailable = document.Get("fullscreenEnabled").Truthy()
+	fingerprint.IdleCallbackLatencyMs = idleCallbackLatencyMs
+	fingerprint.MediaQueryFingerprint = mediaQueryFingerprint(window)
+	fingerprint.BroadcastChannelAvailable = broadcastChannelAvailable
+	fingerprint.CrossTabCommunicationActive = crossTabCommunicationActive
+	fingerprint.FingerprintResistanceDetected = fingerprintResistanceDetected(navigator, document)
+	fingerprint.CSSAnimationTimingPrecisionUs = cssAnimationTimingPrecisionUs
+	fingerprint.StorageQuotaGB = storageQuotaGB
+	fingerprint.StorageUsageMB = storageUsageMB
+	fingerprint.SpeechVoiceCount, fingerprint.SpeechVoiceHash = speechVoices(window)
+	fingerprint.ServiceWorkerAvailable = js.Global().Get("Reflect").Call("has", navigator, "serviceWorker").Bool()
+	fingerprint.ServiceWorkerRegistered = serviceWorkerRegistered
+	fingerprint.CacheAPIAvailable = cacheAPIAvailable
+	fingerprint.EstimatedCacheLatencyMs = estimatedCacheLatencyMs
+	fingerprint.CSSCustomPropertiesSupported = cssSupports(window, "--test", "0")
+	fingerprint.CSSGridSupported = cssSupports(window, "display", "grid")
+	fingerprint.CSSFlexSupported = cssSupports(window, "display", "flex")
+	fingerprint.ClipboardContentHash = clipboardContentHash
+	fingerprint.CanvasHash = canvasHash(document)
+	fingerprint.WebGLRenderer, fingerprint.WebGLVendor, fingerprint.WebGLExtensionCount = webGLInfo(document)
+	fingerprint.WebDriver = navigator.Get("webdriver").Truthy()
+	fingerprint.Languages = navigatorLanguages(navigator)
+	fingerprint.PluginCount = pluginCount(navigator)
+	fingerprint.RTCLocalIPHash = rtcLocalIPHash
+
 	jsonData, err := json.Marshal(fingerprint)
 	if err != nil {
 		return map[string]interface{}{
@@ -106,6 +626,320 @@ func collectFingerprint(this js.Value, args []js.Value) interface{} {
 	}
 }
 
+func screenOrientation(screen js.Value) (string, string) {
+	orientation := screen.Get("orientation")
+	if orientation.IsUndefined() || orientation.IsNull() {
+		return "unsupported", "unsupported"
+	}
+
+	orientationType := orientation.Get("type")
+	if orientationType.Type() != js.TypeString {
+		return "unsupported", "unsupported"
+	}
+
+	value := orientationType.String()
+	return value, strings.SplitN(value, "-", 2)[0]
+}
+
+func webGLContext(document js.Value) js.Value {
+	canvas := document.Call("createElement", "canvas")
+	gl := canvas.Call("getContext", "webgl")
+	if gl.IsNull() || gl.IsUndefined() {
+		gl = canvas.Call("getContext", "experimental-webgl")
+	}
+	return gl
+}
+
+func gpuMaxTextureSize(document js.Value) *int {
+	gl := webGLContext(document)
+	if gl.IsNull() || gl.IsUndefined() {
+		return nil
+	}
+
+	value := gl.Call("getParameter", gl.Get("MAX_TEXTURE_SIZE"))
+	if value.Type() != js.TypeNumber {
+		return nil
+	}
+
+	size := value.Int()
+	return &size
+}
+
+func gpuTier(document js.Value) string {
+	gl := webGLContext(document)
+	if gl.IsNull() || gl.IsUndefined() {
+		return "unsupported"
+	}
+
+	rendererParam := gl.Get("RENDERER")
+	if ext := gl.Call("getExtension", "WEBGL_debug_renderer_info"); !ext.IsNull() {
+		rendererParam = ext.Get("UNMASKED_RENDERER_WEBGL")
+	}
+
+	renderer := gl.Call("getParameter", rendererParam)
+	if renderer.Type() != js.TypeString {
+		return "unsupported"
+	}
+
+	return classifyGPU(renderer.String())
+}
+
+// webGLInfo prefers the unmasked strings from WEBGL_debug_renderer_info,
+// falling back to the generic RENDERER and VENDOR parameters.
+func webGLInfo(document js.Value) (string, string, int) {
+	gl := webGLContext(document)
+	if gl.IsNull() || gl.IsUndefined() {
+		return "unavailable", "unavailable", 0
+	}
+
+	rendererParam, vendorParam := gl.Get("RENDERER"), gl.Get("VENDOR")
+	if ext := gl.Call("getExtension", "WEBGL_debug_renderer_info"); !ext.IsNull() {
+		rendererParam = ext.Get("UNMASKED_RENDERER_WEBGL")
+		vendorParam = ext.Get("UNMASKED_VENDOR_WEBGL")
+	}
+
+	var renderer, vendor string
+	if value := gl.Call("getParameter", rendererParam); value.Type() == js.TypeString {
+		renderer = value.String()
+	}
+	if value := gl.Call("getParameter", vendorParam); value.Type() == js.TypeString {
+		vendor = value.String()
+	}
+
+	extensionCount := 0
+	if extensions := gl.Call("getSupportedExtensions"); !extensions.IsNull() {
+		extensionCount = extensions.Length()
+	}
+
+	return renderer, vendor, extensionCount
+}
+
+func classifyGPU(renderer string) string {
+	data, err := gpuTierFS.ReadFile("gpu_tiers.json")
+	if err != nil {
+		return "tier-1"
+	}
+
+	var rules []gpuTierRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return "tier-1"
+	}
+
+	renderer = strings.ToLower(renderer)
+	for _, rule := range rules {
+		if strings.Contains(renderer, rule.Pattern) {
+			return rule.Tier
+		}
+	}
+
+	return "tier-1"
+}
+
+func pageAgeSeconds() int {
+	timeOrigin := js.Global().Get("performance").Get("timeOrigin")
+	if timeOrigin.Type() != js.TypeNumber {
+		return 0
+	}
+
+	now := js.Global().Get("Date").Call("now").Float()
+	return int((now - timeOrigin.Float()) / 1000)
+}
+
+func supportedMIMEHash(window js.Value) string {
+	mediaSource := window.Get("MediaSource")
+	if mediaSource.IsUndefined() || mediaSource.Get("isTypeSupported").Type() != js.TypeFunction {
+		return "unsupported"
+	}
+
+	bits := make([]byte, (len(mimeTypes)+7)/8)
+	for i, mimeType := range mimeTypes {
+		if mediaSource.Call("isTypeSupported", mimeType).Truthy() {
+			bits[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+
+	hash := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(bits)))
+	return hex.EncodeToString(hash[:])
+}
+
+func mediaQueryFingerprint(window js.Value) string {
+	bits := make([]byte, (len(mediaQueries)+7)/8)
+
+	matchMedia := window.Get("matchMedia")
+	if matchMedia.Type() == js.TypeFunction {
+		for i, query := range mediaQueries {
+			if window.Call("matchMedia", query).Get("matches").Truthy() {
+				bits[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+	}
+
+	return base64.StdEncoding.EncodeToString(bits)
+}
+
+func fingerprintResistanceDetected(navigator, document js.Value) bool {
+	if brave := navigator.Get("brave"); !brave.IsUndefined() && !brave.IsNull() {
+		return true
+	}
+
+	first := canvasProbeHash(document)
+	second := canvasProbeHash(document)
+	return first != second
+}
+
+func cssSupports(window js.Value, property, value string) bool {
+	css := window.Get("CSS")
+	if css.IsUndefined() || css.IsNull() || css.Get("supports").Type() != js.TypeFunction {
+		return false
+	}
+	return css.Call("supports", property, value).Truthy()
+}
+
+// canvasHash renders text with a fallback font, an emoji and a blurred
+// shadow, where font rasterisation, anti-aliasing and GPU differences show up
+// in the pixels.
+func canvasHash(document js.Value) string {
+	canvas := document.Call("createElement", "canvas")
+	canvas.Set("width", 240)
+	canvas.Set("height", 60)
+
+	ctx := canvas.Call("getContext", "2d")
+	if ctx.IsNull() || ctx.IsUndefined() {
+		return "unsupported"
+	}
+
+	ctx.Set("textBaseline", "top")
+	ctx.Set("font", "16px 'Arial', sans-serif")
+	ctx.Set("fillStyle", "#f60")
+	ctx.Call("fillRect", 125, 1, 62, 20)
+	ctx.Set("shadowColor", "rgba(0, 0, 255, 0.6)")
+	ctx.Set("shadowBlur", 4)
+	ctx.Set("shadowOffsetX", 2)
+	ctx.Set("shadowOffsetY", 2)
+	ctx.Set("fillStyle", "#069")
+	ctx.Call("fillText", "wArgon2 Ω ✓ 🦉 ñ", 2, 15)
+	ctx.Set("fillStyle", "rgba(102, 204, 0, 0.7)")
+	ctx.Set("font", "18px serif")
+	ctx.Call("fillText", "wArgon2 Ω ✓ 🦉 ñ", 4, 35)
+
+	hash := sha256.Sum256([]byte(canvas.Call("toDataURL", "image/png").String()))
+	return hex.EncodeToString(hash[:])
+}
+
+func canvasProbeHash(document js.Value) string {
+	canvas := document.Call("createElement", "canvas")
+	canvas.Set("width", 120)
+	canvas.Set("height", 40)
+
+	ctx := canvas.Call("getContext", "2d")
+	if ctx.IsNull() || ctx.IsUndefined() {
+		return ""
+	}
+
+	ctx.Set("fillStyle", "#f60")
+	ctx.Call("fillRect", 10, 5, 60, 30)
+	ctx.Set("fillStyle", "rgba(102, 204, 0, 0.7)")
+	ctx.Call("beginPath")
+	ctx.Call("arc", 80, 20, 15, 0, math.Pi*2)
+	ctx.Call("fill")
+
+	hash := sha256.Sum256([]byte(canvas.Call("toDataURL").String()))
+	return hex.EncodeToString(hash[:])
+}
+
+func navigatorLanguages(navigator js.Value) []string {
+	languages := navigator.Get("languages")
+	if languages.IsUndefined() || languages.IsNull() {
+		return []string{}
+	}
+
+	entries := make([]string, 0, languages.Length())
+	for i := 0; i < languages.Length(); i++ {
+		entries = append(entries, languages.Index(i).String())
+	}
+	return entries
+}
+
+func pluginCount(navigator js.Value) int {
+	plugins := navigator.Get("plugins")
+	if plugins.IsUndefined() || plugins.IsNull() {
+		return 0
+	}
+	return plugins.Length()
+}
+
+func speechVoices(window js.Value) (int, string) {
+	speechSynthesis := window.Get("speechSynthesis")
+	if speechSynthesis.IsUndefined() || speechSynthesis.Get("getVoices").Type() != js.TypeFunction {
+		return 0, "none"
+	}
+
+	voices := speechSynthesis.Call("getVoices")
+	entries := make([]string, 0, voices.Length())
+	for i := 0; i < voices.Length(); i++ {
+		voice := voices.Index(i)
+		entries = append(entries, voice.Get("name").String()+"|"+voice.Get("lang").String())
+	}
+	sort.Strings(entries)
+
+	hash := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return len(entries), hex.EncodeToString(hash[:])
+}
+
+func shadowDOMDepth(root js.Value, depth int) int {
+	maxDepth := depth
+
+	elements := root.Call("querySelectorAll", "*")
+	for i := 0; i < elements.Length(); i++ {
+		shadowRoot := elements.Index(i).Get("shadowRoot")
+		if shadowRoot.IsNull() || shadowRoot.IsUndefined() {
+			continue
+		}
+		if d := shadowDOMDepth(shadowRoot, depth+1); d > maxDepth {
+			maxDepth = d
+		}
+	}
+
+	return maxDepth
+}
+
+func customElementCount(document js.Value) int {
+	registry := js.Global().Get("customElements")
+	if registry.IsUndefined() || registry.IsNull() {
+		return 0
+	}
+
+	seen := make(map[string]bool)
+	elements := document.Call("querySelectorAll", "*")
+	for i := 0; i < elements.Length(); i++ {
+		name := elements.Index(i).Get("localName").String()
+		if seen[name] {
+			continue
+		}
+		if !registry.Call("get", name).IsUndefined() {
+			seen[name] = true
+		}
+	}
+
+	return len(seen)
+}
+
+func timerGranularityUs() float64 {
+	performance := js.Global().Get("performance")
+
+	minDelta := 0.0
+	last := performance.Call("now").Float()
+	for i := 0; i < 1000 || (minDelta == 0 && i < 100000); i++ {
+		now := performance.Call("now").Float()
+		if delta := now - last; delta > 0 && (minDelta == 0 || delta < minDelta) {
+			minDelta = delta
+		}
+		last = now
+	}
+
+	return minDelta * 1000
+}
+
 func encryptData(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
 		return map[string]interface{}{
@@ -134,6 +968,107 @@ func encryptData(this js.Value, args []js.Value) interface{} {
 	}
 }
 
+// solveArgon2 tries attempts consecutive nonces starting at nonce, hashing
+// exactly as the server's verifySolution does. It returns the first nonce
+// whose hash starts with targetPrefix, or found=false and the nonce to
+// resume from so the caller can yield to the event loop between batches.
+// For scrypt challenges time, memory and threads carry N, r and p; variant
+// "i" selects Argon2i and anything else Argon2id.
+func solveArgon2(algorithm, variant, salt string, nonce uint64, time, memory uint32, threads uint8, keyLen uint32, targetPrefix string, attempts int) (found bool, next uint64, hash string, err error) {
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return false, nonce, "", fmt.Errorf("failed to decode salt: %w", err)
+	}
+
+	for i := 0; i < attempts; i++ {
+		input := []byte(salt + strconv.FormatUint(nonce, 16))
+
+		var key []byte
+		if algorithm == "scrypt" {
+			key, err = scrypt.Key(input, saltBytes, int(time), int(memory), int(threads), int(keyLen))
+			if err != nil {
+				return false, nonce, "", fmt.Errorf("failed to compute scrypt hash: %w", err)
+			}
+		} else if variant == "i" {
+			key = argon2.Key(input, saltBytes, time, memory, threads, keyLen)
+		} else {
+			key = argon2.IDKey(input, saltBytes, time, memory, threads, keyLen)
+		}
+
+		hash = hex.EncodeToString(key)
+		if strings.HasPrefix(hash, targetPrefix) {
+			return true, nonce, hash, nil
+		}
+		nonce++
+	}
+
+	return false, nonce, "", nil
+}
+
+func randomNonce() (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// solveArgon2JS(salt, nonce, time, memory, threads, keyLen, target, attempts[, algorithm[, variant]])
+// takes the nonce as a hex string; an empty string starts from a random
+// 64-bit offset so concurrent tabs do not search the same range. algorithm
+// defaults to argon2id and variant to id.
+func solveArgon2JS(this js.Value, args []js.Value) interface{} {
+	if len(args) < 8 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "salt, nonce, time, memory, threads, keyLen, target and attempts required",
+		}
+	}
+
+	var nonce uint64
+	var err error
+	if start := args[1].String(); start == "" {
+		nonce, err = randomNonce()
+	} else {
+		nonce, err = strconv.ParseUint(start, 16, 64)
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "Invalid nonce",
+		}
+	}
+
+	algorithm := "argon2id"
+	if len(args) > 8 && args[8].Type() == js.TypeString {
+		algorithm = args[8].String()
+	}
+
+	variant := "id"
+	if len(args) > 9 && args[9].Type() == js.TypeString {
+		variant = args[9].String()
+	}
+
+	found, next, hash, err := solveArgon2(algorithm, variant, args[0].String(), nonce, uint32(args[2].Int()), uint32(args[3].Int()),
+		uint8(args[4].Int()), uint32(args[5].Int()), args[6].String(), args[7].Int())
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	result := map[string]interface{}{
+		"success": true,
+		"found":   found,
+		"nonce":   strconv.FormatUint(next, 16),
+	}
+	if found {
+		result["hash"] = hash
+	}
+	return result
+}
+
 func encrypt(plaintext []byte, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -150,7 +1085,8 @@ func encrypt(plaintext []byte, key []byte) (string, error) {
 		return "", fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := append([]byte{aesKeyVersion}, nonce...)
+	ciphertext = gcm.Seal(ciphertext, nonce, plaintext, nil)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
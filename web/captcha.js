@@ -1,7 +1,28 @@
+let wasmInstantiationTimeMs = 0;
+
+// Hashes per solveArgon2 call; the page yields to the event loop between calls.
+const SOLVE_BATCH_SIZE = 10;
+
 async function initWASM() {
     console.log('Loading WASM module...');
     const go = new Go();
-    const result = await WebAssembly.instantiateStreaming(fetch("fingerprint.wasm"), go.importObject);
+    const paramsResponse = await fetch('/api/v1/params');
+    if (!paramsResponse.ok) {
+        throw new Error('Failed to fetch WASM checksum');
+    }
+    const params = await paramsResponse.json();
+    const expectedChecksum = params.wasmChecksum || params.wasm_checksum;
+
+    const fetchStart = performance.now();
+    const wasmResponse = await fetch("fingerprint.wasm");
+    const wasmBytes = await wasmResponse.arrayBuffer();
+    const digest = await crypto.subtle.digest('SHA-256', wasmBytes);
+    const checksum = Array.from(new Uint8Array(digest), b => b.toString(16).padStart(2, '0')).join('');
+    if (checksum !== expectedChecksum) {
+        throw new Error('WASM checksum mismatch, refusing to load module');
+    }
+    const result = await WebAssembly.instantiate(wasmBytes, go.importObject);
+    wasmInstantiationTimeMs = Math.round(performance.now() - fetchStart);
     go.run(result.instance);
     console.log('WASM module loaded successfully');
     
@@ -12,13 +33,22 @@ async function initWASM() {
 }
 
 class CaptchaSystem {
-    constructor() {
+    constructor(sessionToken = null) {
         this.challenge = null;
         this.solving = false;
+        this.sessionToken = sessionToken;
     }
 
     async getChallenge() {
-        const response = await fetch('/api/v1/challenge');
+        const response = this.sessionToken
+            ? await fetch('/api/v1/challenge', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ sessionToken: this.sessionToken })
+            })
+            : await fetch('/api/v1/challenge');
         if (!response.ok) {
             throw new Error('Failed to get challenge');
         }
@@ -27,6 +57,23 @@ class CaptchaSystem {
         return data;
     }
 
+    async placeHoneypot(container) {
+        const response = await fetch('/api/v1/challenge?type=honeypot');
+        if (!response.ok) {
+            return;
+        }
+        const data = await response.json();
+
+        const field = document.createElement('input');
+        field.type = 'text';
+        field.name = 'captcha_challenge_id';
+        field.value = data.challenge.id;
+        field.tabIndex = -1;
+        field.autocomplete = 'off';
+        field.style.display = 'none';
+        container.appendChild(field);
+    }
+
     async solveChallenge() {
         if (!this.challenge) {
             throw new Error('No challenge available');
@@ -35,51 +82,38 @@ class CaptchaSystem {
         this.solving = true;
         this.updateStatus('Solving...', 'working');
         
-        let nonce = 0;
-        const startTime = Date.now();
+        let nonce = '';
         
         while (this.solving) {
-            const nonceStr = nonce.toString();
-            const input = this.challenge.salt + nonceStr;
+            const result = solveArgon2(
+                this.challenge.salt,
+                nonce,
+                this.challenge.difficulty || 3,
+                this.challenge.memory || 65536,
+                this.challenge.threads || 1,
+                this.challenge.keyLen || 32,
+                this.challenge.target,
+                SOLVE_BATCH_SIZE,
+                this.challenge.algorithm || 'argon2id',
+                this.challenge.variant || 'id'
+            );
+            if (!result.success) {
+                throw new Error('Hash computation error: ' + result.error);
+            }
             
-            try {
-                const saltBytes = this.base64ToUint8Array(this.challenge.salt);
-                
-                const result = await argon2.hash({
-                    pass: input,
-                    salt: saltBytes,
-                    time: this.challenge.difficulty || 3,
-                    mem: this.challenge.memory || 65536,
-                    parallelism: this.challenge.threads || 1,
-                    hashLen: this.challenge.keyLen || 32,
-                    type: argon2.ArgonType.Argon2id
-                });
+            if (result.found) {
+                this.updateStatus(`✅ Captcha completed`, 'success');
                 
-                const hashStr = this.uint8ArrayToHex(result.hash);
-                
-                if (this.hasValidPrefix(hashStr, this.challenge.target)) {
-                    const elapsed = (Date.now() - startTime) / 1000;
-                    this.updateStatus(`✅ Captcha completed`, 'success');
-                    
-                    return {
-                        challenge: this.challenge,
-                        nonce: nonceStr,
-                        hash: hashStr,
-                        input: input
-                    };
-                }
-                
-                nonce++;
-                
-                if (nonce % 10 === 0) {
-                    await this.sleep(1);
-                }
-                
-            } catch (error) {
-                console.error('Hash computation error:', error);
-                nonce++;
-                continue;
+                return {
+                    challenge: this.challenge,
+                    nonce: result.nonce,
+                    hash: result.hash,
+                    input: this.challenge.salt + result.nonce
+                };
             }
+            
+            nonce = result.nonce;
+            await this.sleep(1);
         }
         
         throw new Error('Solving was aborted');
@@ -87,7 +121,7 @@ class CaptchaSystem {
 
     async verifySolution(solution) {
         console.log('Collecting fingerprint...');
-        const fingerprintResult = collectFingerprint();
+        const fingerprintResult = collectFingerprint(wasmInstantiationTimeMs);
         console.log('Fingerprint result:', fingerprintResult);
         if (!fingerprintResult.success) {
             throw new Error('Failed to collect fingerprint: ' + fingerprintResult.error);
@@ -102,7 +136,8 @@ class CaptchaSystem {
                 challengeId: solution.challenge.id,
                 nonce: solution.nonce,
                 hash: solution.hash,
-                fingerprint: fingerprintResult.fingerprint
+                fingerprint: fingerprintResult.fingerprint,
+                sessionToken: this.sessionToken || undefined
             })
         });
         
@@ -114,25 +149,6 @@ class CaptchaSystem {
         return result.valid;
     }
 
-    base64ToUint8Array(base64) {
-        const binary = atob(base64);
-        const bytes = new Uint8Array(binary.length);
-        for (let i = 0; i < binary.length; i++) {
-            bytes[i] = binary.charCodeAt(i);
-        }
-        return bytes;
-    }
-
-    uint8ArrayToHex(uint8Array) {
-        return Array.from(uint8Array)
-            .map(b => b.toString(16).padStart(2, '0'))
-            .join('');
-    }
-
-    hasValidPrefix(hash, prefix) {
-        return hash.startsWith(prefix);
-    }
-
     sleep(ms) {
         return new Promise(resolve => setTimeout(resolve, ms));
     }
@@ -158,9 +174,10 @@ document.addEventListener('DOMContentLoaded', async () => {
     try {
         await initWASM();
         
-        captcha = new CaptchaSystem();
-        
         const button = document.getElementById('solve-captcha');
+        captcha = new CaptchaSystem(button.dataset.sessionToken || null);
+
+        captcha.placeHoneypot(button.parentElement).catch(error => console.error('Honeypot error:', error));
 
         button.addEventListener('click', async () => {
             button.disabled = true;